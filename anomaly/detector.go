@@ -0,0 +1,244 @@
+package anomaly
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/awakari/metrics/service"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/common/model"
+	"log/slog"
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Detector periodically compares the current rates with their seasonal baseline:
+// the rates at the same time of the week over the previous weeks.
+type Detector interface {
+
+	// Start runs the detection every interval until the context is done.
+	Start(ctx context.Context)
+
+	// Detect compares the current rates with the baseline once.
+	Detect(ctx context.Context) (rates []Rate, err error)
+
+	// Report returns the result of the last detection.
+	Report() Report
+}
+
+type Direction string
+
+const (
+	DirectionNone  Direction = ""
+	DirectionDrop  Direction = "drop"
+	DirectionSpike Direction = "spike"
+)
+
+// Rate is the single rate check result.
+type Rate struct {
+	Name   string  `json:"name"`
+	Metric string  `json:"metric"`
+	Value  float64 `json:"value"`
+	// Baseline is the mean rate at the same time of the week over the previous weeks.
+	Baseline float64 `json:"baseline"`
+	Stddev   float64 `json:"stddev"`
+	Samples  int     `json:"samples"`
+	// Change is the relative difference from the baseline, e.g. -0.9 means 90% below the baseline.
+	Change float64 `json:"change"`
+	// Score is the difference from the baseline in the standard deviations, 0 when the baseline has no deviation.
+	Score     float64   `json:"score"`
+	Direction Direction `json:"direction,omitempty"`
+}
+
+type Report struct {
+	Time      time.Time `json:"time"`
+	Anomalies []Rate    `json:"anomalies"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// Config defines the detection sensitivity.
+type Config struct {
+	Interval time.Duration
+	// Window is the rate range selector duration.
+	Window time.Duration
+	// Weeks is the number of the previous weeks to compute the baseline from.
+	Weeks uint32
+	// Threshold is the minimum absolute Score to treat the rate as anomalous.
+	Threshold float64
+	// MinChange is the minimum absolute Change to treat the rate as anomalous.
+	MinChange float64
+}
+
+const fmtQueryRate = "sum(rate(%s[%s]))"
+const week = 7 * 24 * time.Hour
+
+// minSamples is the minimum baseline size to tell anything.
+const minSamples = 2
+
+var gaugeDetected = promauto.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "awk_metrics_anomaly_detected",
+		Help: "Rate anomaly detected: -1 for drop, 1 for spike, 0 when none",
+	},
+	[]string{"rate"},
+)
+var gaugeChange = promauto.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "awk_metrics_anomaly_change",
+		Help: "Rate relative difference from its seasonal baseline",
+	},
+	[]string{"rate"},
+)
+
+type detector struct {
+	svc          service.Service
+	metricByName map[string]string
+	cfg          Config
+	log          *slog.Logger
+	lock         *sync.Mutex
+	report       *Report
+}
+
+// NewDetector returns the Detector of the rates of the given counter metrics by the rate names.
+func NewDetector(svc service.Service, metricByName map[string]string, cfg Config, log *slog.Logger) Detector {
+	return detector{
+		svc:          svc,
+		metricByName: metricByName,
+		cfg:          cfg,
+		log:          log,
+		lock:         &sync.Mutex{},
+		report: &Report{
+			Anomalies: []Rate{},
+		},
+	}
+}
+
+func (d detector) Start(ctx context.Context) {
+	t := time.NewTicker(d.cfg.Interval)
+	defer t.Stop()
+	for {
+		d.update(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (d detector) update(ctx context.Context) {
+	// don't let the slow detection overlap the next one
+	ctx, cancel := context.WithTimeout(ctx, d.cfg.Interval)
+	defer cancel()
+	rates, err := d.Detect(ctx)
+	r := Report{
+		Time:      time.Now().UTC(),
+		Anomalies: []Rate{},
+	}
+	if err != nil {
+		r.Error = err.Error()
+		d.log.Warn("anomaly detection failure", "err", err)
+	}
+	for _, rate := range rates {
+		var detected float64
+		switch rate.Direction {
+		case DirectionDrop:
+			detected = -1
+		case DirectionSpike:
+			detected = 1
+		}
+		if detected != 0 {
+			r.Anomalies = append(r.Anomalies, rate)
+			d.log.Warn("anomaly detected", "rate", rate.Name, "metric", rate.Metric, "value", rate.Value, "baseline", rate.Baseline, "change", rate.Change, "score", rate.Score, "direction", rate.Direction)
+		}
+		gaugeDetected.WithLabelValues(rate.Name).Set(detected)
+		gaugeChange.WithLabelValues(rate.Name).Set(rate.Change)
+	}
+	for name := range d.metricByName {
+		if !slices.ContainsFunc(rates, func(rate Rate) bool { return rate.Name == name }) {
+			// failed, don't keep exposing the previous result
+			gaugeDetected.DeleteLabelValues(name)
+			gaugeChange.DeleteLabelValues(name)
+		}
+	}
+	d.lock.Lock()
+	*d.report = r
+	d.lock.Unlock()
+}
+
+func (d detector) Detect(ctx context.Context) (rates []Rate, err error) {
+	for name, metric := range d.metricByName {
+		rate, errRate := d.detect(ctx, name, metric)
+		switch errRate {
+		case nil:
+			rates = append(rates, rate)
+		default:
+			err = errors.Join(err, fmt.Errorf("%s: %w", name, errRate))
+		}
+	}
+	return
+}
+
+func (d detector) detect(ctx context.Context, name, metric string) (rate Rate, err error) {
+	rate.Name = name
+	rate.Metric = metric
+	q := fmt.Sprintf(fmtQueryRate, metric, model.Duration(d.cfg.Window))
+	rate.Value, _, err = d.svc.GetValue(ctx, q)
+	if errors.Is(err, service.ErrEmptyResult) {
+		// no events at all is the drop to zero
+		err = nil
+	}
+	var baseline []service.Point
+	if err == nil {
+		// truncate to have the same time points during the detection interval
+		end := time.Now().UTC().Truncate(d.cfg.Interval).Add(-week)
+		start := end.Add(-time.Duration(max(d.cfg.Weeks, minSamples)-1) * week)
+		baseline, _, err = d.svc.GetSeries(ctx, q, start, end, week)
+	}
+	if err == nil {
+		rate = evaluate(rate, baseline, d.cfg)
+	}
+	return
+}
+
+func evaluate(rate Rate, baseline []service.Point, cfg Config) Rate {
+	rate.Samples = len(baseline)
+	if rate.Samples < minSamples {
+		return rate
+	}
+	var sum float64
+	for _, p := range baseline {
+		sum += p.Value
+	}
+	rate.Baseline = sum / float64(rate.Samples)
+	var sumSq float64
+	for _, p := range baseline {
+		sumSq += (p.Value - rate.Baseline) * (p.Value - rate.Baseline)
+	}
+	rate.Stddev = math.Sqrt(sumSq / float64(rate.Samples-1))
+	if rate.Baseline > 0 {
+		rate.Change = (rate.Value - rate.Baseline) / rate.Baseline
+	}
+	if rate.Stddev > 0 {
+		rate.Score = (rate.Value - rate.Baseline) / rate.Stddev
+	}
+	if math.Abs(rate.Change) >= cfg.MinChange && (rate.Stddev == 0 || math.Abs(rate.Score) >= cfg.Threshold) {
+		switch {
+		case rate.Change < 0:
+			rate.Direction = DirectionDrop
+		default:
+			rate.Direction = DirectionSpike
+		}
+	}
+	return rate
+}
+
+func (d detector) Report() (r Report) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	r = *d.report
+	return
+}
@@ -0,0 +1,121 @@
+package anomaly
+
+import (
+	"context"
+	"errors"
+	"github.com/awakari/metrics/service"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+type svcFake struct {
+	service.Service
+	value    float64
+	baseline []float64
+	err      error
+}
+
+func (s svcFake) GetValue(ctx context.Context, query string) (val float64, warns service.Warnings, err error) {
+	val = s.value
+	err = s.err
+	return
+}
+
+func (s svcFake) GetSeries(ctx context.Context, metricName string, start, end time.Time, step time.Duration) (series []service.Point, warns service.Warnings, err error) {
+	series = []service.Point{}
+	for i, v := range s.baseline {
+		series = append(series, service.Point{
+			Time:  start.Add(time.Duration(i) * step).Unix(),
+			Value: v,
+		})
+	}
+	return
+}
+
+func TestDetector_Detect(t *testing.T) {
+	cfg := Config{
+		Interval:  time.Minute,
+		Window:    time.Hour,
+		Weeks:     4,
+		Threshold: 3,
+		MinChange: 0.5,
+	}
+	cases := map[string]struct {
+		value     float64
+		baseline  []float64
+		direction Direction
+	}{
+		"normal": {
+			value:    10,
+			baseline: []float64{9, 10, 11, 10},
+		},
+		"drop": {
+			value:     1,
+			baseline:  []float64{9, 10, 11, 10},
+			direction: DirectionDrop,
+		},
+		"spike": {
+			value:     30,
+			baseline:  []float64{9, 10, 11, 10},
+			direction: DirectionSpike,
+		},
+		"change within the deviation": {
+			value:    1,
+			baseline: []float64{0, 20, 0, 20},
+		},
+		"constant baseline": {
+			value:     0,
+			baseline:  []float64{10, 10, 10},
+			direction: DirectionDrop,
+		},
+		"no history": {
+			value: 0,
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			d := NewDetector(
+				svcFake{value: c.value, baseline: c.baseline},
+				map[string]string{"publish": "awk_published_events_count"},
+				cfg,
+				slog.New(slog.NewTextHandler(io.Discard, nil)),
+			)
+			rates, err := d.Detect(context.TODO())
+			assert.Nil(t, err)
+			assert.Equal(t, 1, len(rates))
+			assert.Equal(t, c.direction, rates[0].Direction)
+			assert.Equal(t, len(c.baseline), rates[0].Samples)
+			d.(detector).update(context.TODO())
+			r := d.Report()
+			assert.Equal(t, c.direction != DirectionNone, len(r.Anomalies) == 1)
+		})
+	}
+}
+
+func TestDetector_Update_Failed(t *testing.T) {
+	cfg := Config{
+		Interval:  time.Minute,
+		Window:    time.Hour,
+		Weeks:     4,
+		Threshold: 3,
+		MinChange: 0.5,
+	}
+	metricByName := map[string]string{"failing": "awk_failing_count"}
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	d := NewDetector(svcFake{value: 0, baseline: []float64{10, 10, 10}}, metricByName, cfg, log)
+	d.(detector).update(context.TODO())
+	assert.Equal(t, float64(-1), testutil.ToFloat64(gaugeDetected.WithLabelValues("failing")))
+	countDetected, countChange := testutil.CollectAndCount(gaugeDetected), testutil.CollectAndCount(gaugeChange)
+	// the previous result is not exposed anymore
+	d = NewDetector(svcFake{err: errors.New("unavailable")}, metricByName, cfg, log)
+	d.(detector).update(context.TODO())
+	assert.Equal(t, countDetected-1, testutil.CollectAndCount(gaugeDetected))
+	assert.Equal(t, countChange-1, testutil.CollectAndCount(gaugeChange))
+	r := d.Report()
+	assert.Empty(t, r.Anomalies)
+	assert.Contains(t, r.Error, "failing: unavailable")
+}
@@ -5,15 +5,19 @@ import (
 	"errors"
 	"fmt"
 	"github.com/awakari/metrics/api/grpc/limits"
+	"github.com/awakari/metrics/api/grpc/source"
 	"github.com/awakari/metrics/api/grpc/source/activitypub"
-	"github.com/awakari/metrics/api/grpc/source/feeds"
-	"github.com/awakari/metrics/api/grpc/source/sites"
-	"github.com/awakari/metrics/api/grpc/source/telegram"
+	"github.com/awakari/metrics/catalog"
 	"github.com/awakari/metrics/model"
+	"github.com/awakari/metrics/promql"
 	"github.com/awakari/metrics/service"
+	"github.com/awakari/metrics/trending"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
-	"strings"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"log/slog"
+	"strconv"
+	"sync"
 	"time"
 )
 
@@ -24,168 +28,271 @@ type Controller interface {
 type controller struct {
 	svcLimits      limits.Service
 	svc            service.Service
-	pubMinHourly   int64
-	pubMinDaily    int64
-	pubMaxHourly   int64
-	pubMaxDaily    int64
-	svcFeeds       feeds.Service
-	svcSites       sites.Service
-	svcTg          telegram.Service
+	policies       LimitPolicies
+	limitExpires   time.Duration
+	parallelism    uint32
+	callTimeout    time.Duration
+	resolver       source.Resolver
 	svcAp          activitypub.Service
+	tracker        trending.Tracker
 	groupIdDefault string
+	metrics        catalog.Metrics
+	periodMin      time.Duration
+	periodMax      time.Duration
+	log            *slog.Logger
 }
 
-const limitAutoExpirationDefault = 1 * time.Hour
 const limitAutoExpirationThreshold = 15 * time.Minute
 
+// deadlineReserve is the time left to respond with the partial results before the request deadline.
+const deadlineReserve = 1 * time.Second
+
+var sourceTypes = map[source.Type]SourceType{
+	source.TypeFeed:        SourceType_Feed,
+	source.TypeSite:        SourceType_Site,
+	source.TypeTelegram:    SourceType_Telegram,
+	source.TypeActivityPub: SourceType_ActivityPub,
+}
+
 func NewController(
 	svcLimits limits.Service,
 	svcMetrics service.Service,
-	pubMinHourly int64,
-	pubMinDaily int64,
-	pubMaxHourly int64,
-	pubMaxDaily int64,
-	svcFeeds feeds.Service,
-	svcSites sites.Service,
-	svcTg telegram.Service,
+	policies LimitPolicies,
+	limitExpires time.Duration,
+	parallelism uint32,
+	callTimeout time.Duration,
+	resolver source.Resolver,
 	svcAp activitypub.Service,
+	tracker trending.Tracker,
 	groupIdDefault string,
+	metrics catalog.Metrics,
+	periodMin time.Duration,
+	periodMax time.Duration,
+	log *slog.Logger,
 ) Controller {
 	return controller{
 		svcLimits:      svcLimits,
 		svc:            svcMetrics,
-		pubMinHourly:   pubMinHourly,
-		pubMinDaily:    pubMinDaily,
-		pubMaxHourly:   pubMaxHourly,
-		pubMaxDaily:    pubMaxDaily,
-		svcFeeds:       svcFeeds,
-		svcSites:       svcSites,
-		svcTg:          svcTg,
+		policies:       policies,
+		limitExpires:   limitExpires,
+		parallelism:    parallelism,
+		callTimeout:    callTimeout,
+		resolver:       resolver,
 		svcAp:          svcAp,
+		tracker:        tracker,
 		groupIdDefault: groupIdDefault,
+		metrics:        metrics,
+		periodMin:      periodMin,
+		periodMax:      periodMax,
+		log:            log,
 	}
 }
 
 func (c controller) SetMostReadLimits(ctx context.Context, req *SetMostReadLimitsRequest) (resp *SetMostReadLimitsResponse, err error) {
 	resp = &SetMostReadLimitsResponse{}
+	start := time.Now()
 	var rateBySrc map[string]float64
 	if c.svc != nil {
 		resp.HourlyLimitBySource = make(map[string]int64)
 		resp.DailyLimitBySource = make(map[string]int64)
 		var rateSum float64
-		rateSum, err = c.svc.GetRateAverage(ctx, "awk_reader_read_count", "service", "1d")
+		rateSum, _, err = c.svc.GetRateAverage(ctx, c.metrics.ReadCount, "service", "1d")
 		if err == nil {
-			rateBySrc, err = c.svc.GetRelativeRateByLabel(ctx, rateSum, "awk_reader_sources_read_count", "source", "1d")
+			// nothing to limit when nothing was read
+			rateBySrc, _, err = c.svc.GetRelativeRateByLabel(ctx, rateSum, c.metrics.SourcesReadCount, "source", "1d")
 		}
 	}
 	if err == nil && len(rateBySrc) > 0 {
+		for sl := range c.setSourcesLimits(ctx, rateBySrc, req.DryRun) {
+			c.log.InfoContext(ctx, "SetMostReadLimits", "source", sl.Source, "type", sl.Type.String(), "rateRel", sl.RateRel, "hourly", sl.Hourly.GetAction().String(), "daily", sl.Daily.GetAction().String(), "skipReason", sl.SkipReason, "err", sl.Error)
+			observeSourceLimits(sl, req.DryRun)
+			resp.Sources = append(resp.Sources, sl)
+			if sl.Hourly.GetAction() == LimitAction_Set {
+				resp.HourlyLimitBySource[sl.Source] = sl.Hourly.Count
+			}
+			if sl.Daily.GetAction() == LimitAction_Set {
+				resp.DailyLimitBySource[sl.Source] = sl.Daily.Count
+			}
+		}
+		for _, rateRel := range rateBySrc {
+			if rateRel > 0 {
+				resp.SourcesRemaining++
+			}
+		}
+		resp.SourcesRemaining -= int32(len(resp.Sources))
+		if resp.SourcesRemaining > 0 {
+			resp.Incomplete = true
+			c.log.WarnContext(ctx, "SetMostReadLimits: incomplete", "sourcesRemaining", resp.SourcesRemaining, "err", ctx.Err())
+		}
+	}
+	if err == nil {
+		histLimitsRunDuration.WithLabelValues(strconv.FormatBool(req.DryRun), strconv.FormatBool(resp.Incomplete)).Observe(time.Since(start).Seconds())
+	}
+	err = encodeError(err)
+	return
+}
+
+// setSourcesLimits processes the sources in parallel using the bounded number of workers.
+// Stops taking the new sources shortly before the request deadline or when the request is cancelled.
+func (c controller) setSourcesLimits(ctx context.Context, rateBySrc map[string]float64, dryRun bool) (results chan *SourceLimits) {
+	rankBySrc := PercentileRanks(rateBySrc)
+	var ctxWork context.Context
+	var cancel context.CancelFunc
+	switch deadline, ok := ctx.Deadline(); ok {
+	case true:
+		ctxWork, cancel = context.WithDeadline(ctx, deadline.Add(-deadlineReserve))
+	default:
+		ctxWork, cancel = context.WithCancel(ctx)
+	}
+	srcUrls := make(chan string)
+	go func() {
+		defer close(srcUrls)
 		for srcUrl, rateRel := range rateBySrc {
 			if rateRel > 0 {
-				var groupId string
-				var userId string
-				switch {
-				case strings.HasPrefix(srcUrl, "site:"):
-					var srcSite *sites.Site
-					srcSite, _ = c.svcSites.Read(ctx, srcUrl[5:])
-					if srcSite != nil {
-						groupId = srcSite.GroupId
-						userId = srcSite.UserId
-					}
-				default:
-					if groupId == "" {
-						var srcFeed *feeds.Feed
-						srcFeed, _ = c.svcFeeds.Read(ctx, srcUrl)
-						if srcFeed != nil {
-							groupId = srcFeed.GroupId
-							userId = srcFeed.UserId
-						}
-					}
-					if groupId == "" {
-						var srcAp *activitypub.Source
-						srcAp, _ = c.svcAp.Read(ctx, srcUrl)
-						if srcAp != nil {
-							groupId = srcAp.GroupId
-							userId = srcAp.UserId
-						}
-					}
-					if groupId == "" {
-						var srcTgCh *telegram.Channel
-						srcTgCh, _ = c.svcTg.Read(ctx, srcUrl)
-						if srcTgCh != nil {
-							groupId = srcTgCh.GroupId
-							userId = srcTgCh.UserId
-						}
-					}
-					if groupId == "" {
-						var srcSite *sites.Site
-						srcSite, _ = c.svcSites.Read(ctx, srcUrl[5:])
-						if srcSite != nil {
-							groupId = srcSite.GroupId
-							userId = srcSite.UserId
-						}
-					}
+				select {
+				case srcUrls <- srcUrl:
+				case <-ctxWork.Done():
+					return
 				}
-				if groupId == "" {
-					srcUrl, err = c.svcAp.Create(ctx, srcUrl, c.groupIdDefault, srcUrl)
-					if err != nil {
-						err = nil
-						continue
-					}
-					groupId = c.groupIdDefault
-					userId = srcUrl
-				}
-				if userId != "" && userId != srcUrl {
-					fmt.Printf("SetMostReadLimits: source %s is sharing the limit of %s, skipping the automatic limit setting\n", srcUrl, userId)
-					continue
-				}
-
-				var l model.Limit
-
-				// hourly limit
-				l, err = c.svcLimits.GetRaw(ctx, groupId, srcUrl, model.SubjectPublishHourly)
-				switch {
-				case errors.Is(err, limits.ErrNotFound):
-					fallthrough
-				case !l.Expires.IsZero() && l.Expires.Before(time.Now().UTC().Add(limitAutoExpirationThreshold)):
-					l.Count = c.pubMinHourly + int64(float64(c.pubMaxHourly)*rateRel)
-					l.Expires = time.Now().UTC().Add(limitAutoExpirationDefault)
-					err = c.svcLimits.Set(ctx, groupId, srcUrl, model.SubjectPublishHourly, l.Count, l.Expires)
-					if err == nil {
-						resp.HourlyLimitBySource[srcUrl] = l.Count
-					}
-				default:
-					fmt.Printf("SetMostReadLimits: source %s has a limit that isn't expiring (%s), skipping\n", srcUrl, l.Expires)
+			}
+		}
+	}()
+	results = make(chan *SourceLimits)
+	wg := &sync.WaitGroup{}
+	for i := uint32(0); i < max(c.parallelism, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for srcUrl := range srcUrls {
+				in := LimitInput{
+					RateRel: rateBySrc[srcUrl],
+					Rank:    rankBySrc[srcUrl],
 				}
+				results <- c.setSourceLimits(ctxWork, srcUrl, in, dryRun)
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		cancel()
+		close(results)
+	}()
+	return
+}
 
-				// daily limit
-				l, err = c.svcLimits.GetRaw(ctx, groupId, srcUrl, model.SubjectPublishDaily)
-				switch {
-				case errors.Is(err, limits.ErrNotFound):
-					fallthrough
-				case !l.Expires.IsZero() && l.Expires.Before(time.Now().UTC().Add(limitAutoExpirationThreshold)):
-					l.Count = c.pubMinDaily + int64(float64(c.pubMaxDaily)*rateRel)
-					l.Expires = time.Now().UTC().Add(limitAutoExpirationDefault)
-					err = c.svcLimits.Set(ctx, groupId, srcUrl, model.SubjectPublishDaily, l.Count, l.Expires)
-					if err == nil {
-						resp.DailyLimitBySource[srcUrl] = l.Count
-					}
-				default:
-					fmt.Printf("SetMostReadLimits: source %s has a limit that isn't expiring (%s), skipping\n", srcUrl, l.Expires)
-				}
+func (c controller) setSourceLimits(ctx context.Context, srcUrl string, in LimitInput, dryRun bool) (sl *SourceLimits) {
+	sl = &SourceLimits{
+		Source:  srcUrl,
+		RateRel: in.RateRel,
+	}
+	var groupId string
+	var userId string
+	ctxCall, cancel := c.callContext(ctx)
+	src, err := c.resolver.Resolve(ctxCall, srcUrl)
+	cancel()
+	switch {
+	case err == nil:
+		groupId = src.GroupId
+		userId = src.UserId
+		sl.Type = sourceTypes[src.Type]
+	case errors.Is(err, source.ErrNotFound):
+	default:
+		sl.Error = fmt.Sprintf("failed to resolve the source: %s", err)
+		return
+	}
+	if groupId == "" {
+		if !dryRun {
+			ctxCall, cancel = c.callContext(ctx)
+			srcUrl, err = c.svcAp.Create(ctxCall, srcUrl, c.groupIdDefault, srcUrl)
+			cancel()
+			if err != nil {
+				sl.Error = fmt.Sprintf("failed to create the activitypub source: %s", err)
+				return
+			}
+			sl.Source = srcUrl
+		}
+		groupId = c.groupIdDefault
+		userId = srcUrl
+		sl.Type = SourceType_Created
+	}
+	sl.GroupId = groupId
+	sl.UserId = userId
+	if userId != "" && userId != srcUrl {
+		sl.SkipReason = fmt.Sprintf("sharing the limit of %s", userId)
+		return
+	}
+	hourly, daily := c.policies.Of(sl.Type).Limits(in)
+	sl.Hourly = c.setLimit(ctx, groupId, srcUrl, model.SubjectPublishHourly, hourly, dryRun)
+	sl.Daily = c.setLimit(ctx, groupId, srcUrl, model.SubjectPublishDaily, daily, dryRun)
+	return
+}
 
-				err = nil
+func (c controller) setLimit(ctx context.Context, groupId, userId string, subj model.Subject, count int64, dryRun bool) (l *Limit) {
+	l = &Limit{}
+	ctxCall, cancel := c.callContext(ctx)
+	prev, err := c.svcLimits.GetRaw(ctxCall, groupId, userId, subj)
+	cancel()
+	if err == nil {
+		l.PrevCount = prev.Count
+		if !prev.Expires.IsZero() {
+			l.PrevExpires = timestamppb.New(prev.Expires)
+		}
+	}
+	switch {
+	case errors.Is(err, limits.ErrNotFound):
+		fallthrough
+	case !prev.Expires.IsZero() && prev.Expires.Before(time.Now().UTC().Add(limitAutoExpirationThreshold)):
+		expires := time.Now().UTC().Add(c.limitExpires)
+		l.Count = count
+		l.Expires = timestamppb.New(expires)
+		switch dryRun {
+		case true:
+			l.Action = LimitAction_WouldSet
+		default:
+			l.Action = LimitAction_Set
+			ctxCall, cancel = c.callContext(ctx)
+			err = c.svcLimits.Set(ctxCall, groupId, userId, subj, count, expires)
+			cancel()
+			if err != nil {
+				l.Action = LimitAction_Failed
+				l.Error = fmt.Sprintf("failed to set: %s", err)
 			}
 		}
+	case err != nil:
+		l.Action = LimitAction_Failed
+		l.Error = fmt.Sprintf("failed to get the current limit: %s", err)
+	default:
+		l.Action = LimitAction_Kept
+		l.SkipReason = fmt.Sprintf("limit isn't expiring (%s)", prev.Expires)
 	}
-	err = encodeError(err)
 	return
 }
 
+// callContext limits the duration of the single backend call.
+func (c controller) callContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.callTimeout > 0 {
+		return context.WithTimeout(ctx, c.callTimeout)
+	}
+	return context.WithCancel(ctx)
+}
+
 func encodeError(src error) (dst error) {
 	switch {
 	case src == nil:
 	case errors.Is(src, limits.ErrInternal):
 		dst = status.Error(codes.Internal, src.Error())
+	case errors.Is(src, service.ErrBadQuery), errors.Is(src, promql.ErrInvalid):
+		dst = status.Error(codes.InvalidArgument, src.Error())
+	case errors.Is(src, service.ErrEmptyResult):
+		dst = status.Error(codes.NotFound, src.Error())
+	case errors.Is(src, service.ErrTimeout):
+		dst = status.Error(codes.DeadlineExceeded, src.Error())
+	case errors.Is(src, service.ErrCanceled):
+		dst = status.Error(codes.Canceled, src.Error())
+	case errors.Is(src, service.ErrUnavailable):
+		dst = status.Error(codes.Unavailable, src.Error())
+	case status.Code(src) != codes.Unknown:
+		dst = src // already encoded
 	default:
 		dst = status.Error(codes.Unknown, src.Error())
 	}
@@ -0,0 +1,156 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/awakari/metrics/promql"
+	"github.com/awakari/metrics/service"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"time"
+)
+
+const durationQuantilesPeriod = 5 * time.Minute
+const readStatusLimitDefault = 10
+const readStatusLimitMax = 1_000
+const readStatusOffsetMax = 10_000
+
+func (c controller) GetPublishRate(ctx context.Context, req *GetPublishRateRequest) (resp *GetPublishRateResponse, err error) {
+	resp = &GetPublishRateResponse{}
+	var period string
+	period, err = promql.ParsePeriod(req.Period, c.periodMin, c.periodMax)
+	var warns service.Warnings
+	if err == nil {
+		resp.Rate, warns, err = c.svc.GetRateAverage(ctx, c.metrics.PublishedEvents, "service", period)
+		resp.Warnings = warns
+	}
+	err = encodeError(err)
+	return
+}
+
+func (c controller) GetReadStatus(ctx context.Context, req *GetReadStatusRequest) (resp *GetReadStatusResponse, err error) {
+	resp = &GetReadStatusResponse{}
+	var period string
+	period, err = promql.ParsePeriod(req.Period, c.periodMin, c.periodMax)
+	var s service.ReadStatus
+	var warns service.Warnings
+	if err == nil {
+		limit := req.Limit
+		switch {
+		case req.Offset > readStatusOffsetMax:
+			err = status.Errorf(codes.InvalidArgument, "offset should not be more than %d: %d", readStatusOffsetMax, req.Offset)
+		case limit > readStatusLimitMax:
+			err = status.Errorf(codes.InvalidArgument, "limit should not be more than %d: %d", readStatusLimitMax, limit)
+		case limit == 0 && req.Offset > 0:
+			// the zero limit means all the sources, as before the paging was added, when no page is requested only
+			limit = readStatusLimitDefault
+		}
+		if err == nil {
+			s, warns, err = service.GetReadStatus(ctx, c.svc, c.metrics.ReadCount, c.metrics.SourcesReadCount, period, req.Offset, limit)
+			resp.Rate = s.ReadRate
+			resp.SourcesMostRead = s.SourcesMostRead
+			for _, src := range s.Sources {
+				resp.Sources = append(resp.Sources, &SourceShare{
+					Source: src.Source,
+					Share:  src.Share,
+				})
+			}
+			resp.Other = s.Other
+			resp.Warnings = warns
+		}
+	}
+	err = encodeError(err)
+	return
+}
+
+func (c controller) GetFollowers(ctx context.Context, req *GetFollowersRequest) (resp *GetFollowersResponse, err error) {
+	resp = &GetFollowersResponse{}
+	var nh service.NumberHistory
+	var warns service.Warnings
+	nh, warns, err = c.svc.GetNumberHistory(ctx, c.metrics.Followers)
+	resp.Count = encodeNumberHistory(nh)
+	resp.Warnings = warns
+	err = encodeError(err)
+	return
+}
+
+func (c controller) GetDurationQuantiles(ctx context.Context, req *GetDurationQuantilesRequest) (resp *GetDurationQuantilesResponse, err error) {
+	resp = &GetDurationQuantilesResponse{}
+	var dur service.Duration
+	var warns service.Warnings
+	dur, warns, err = service.GetDurationQuantiles(ctx, c.svc, c.metrics.DurationBucket, durationQuantilesPeriod)
+	resp.Q0_5 = dur.Quantile05
+	resp.Q0_75 = dur.Quantile075
+	resp.Q0_95 = dur.Quantile095
+	resp.Q0_99 = dur.Quantile099
+	resp.Warnings = warns
+	err = encodeError(err)
+	return
+}
+
+func (c controller) GetAttributeTypes(ctx context.Context, req *GetAttributeTypesRequest) (resp *GetAttributeTypesResponse, err error) {
+	resp = &GetAttributeTypesResponse{
+		TypesByKey: make(map[string]*AttributeTypes),
+	}
+	var attrs service.Attributes
+	var warns service.Warnings
+	attrs, warns, err = c.svc.GetEventAttributeTypes(ctx, c.metrics.AttrsObserved, "key, type", "1w")
+	if err == nil {
+		attrs = service.PublicAttributeTypes(attrs)
+		for k, types := range attrs.TypesByKey {
+			resp.TypesByKey[k] = &AttributeTypes{
+				Types: types,
+			}
+		}
+	}
+	resp.Warnings = warns
+	err = encodeError(err)
+	return
+}
+
+func (c controller) GetAttributeValues(ctx context.Context, req *GetAttributeValuesRequest) (resp *GetAttributeValuesResponse, err error) {
+	resp = &GetAttributeValuesResponse{}
+	var warns service.Warnings
+	switch promql.ValidName(req.Name) {
+	case true:
+		resp.Values, warns, err = c.svc.GetEventAttributeValuesByName(ctx, c.metrics.PublishedEvents, req.Name)
+		resp.Warnings = warns
+	default:
+		err = fmt.Errorf("%w: attribute name %q", promql.ErrInvalid, req.Name)
+	}
+	err = encodeError(err)
+	return
+}
+
+func (c controller) GetSourceCounts(ctx context.Context, req *GetSourceCountsRequest) (resp *GetSourceCountsResponse, err error) {
+	resp = &GetSourceCountsResponse{}
+	var nh service.NumberHistory
+	var warns service.Warnings
+	for _, src := range []struct {
+		metricName string
+		dst        **NumberHistory
+	}{
+		{c.metrics.SourcesFeeds, &resp.Feeds},
+		{c.metrics.SourcesSocials, &resp.Socials},
+		{c.metrics.SourcesRealtime, &resp.Realtime},
+	} {
+		var errSrc error
+		nh, warns, errSrc = c.svc.GetNumberHistory(ctx, src.metricName)
+		*src.dst = encodeNumberHistory(nh)
+		resp.Warnings = append(resp.Warnings, warns...)
+		err = errors.Join(err, errSrc)
+	}
+	err = encodeError(err)
+	return
+}
+
+func encodeNumberHistory(src service.NumberHistory) (dst *NumberHistory) {
+	dst = &NumberHistory{
+		Current:   src.Current,
+		PastHour:  src.Past.Hour,
+		PastDay:   src.Past.Day,
+		PastMonth: src.Past.Month,
+	}
+	return
+}
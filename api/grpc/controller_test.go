@@ -0,0 +1,224 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/awakari/metrics/api/grpc/limits"
+	"github.com/awakari/metrics/api/grpc/source"
+	"github.com/awakari/metrics/api/grpc/source/activitypub"
+	"github.com/awakari/metrics/catalog"
+	"github.com/awakari/metrics/config"
+	"github.com/awakari/metrics/model"
+	"github.com/awakari/metrics/service"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io"
+	"log/slog"
+	"math"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type metricsFake struct {
+	service.Service
+	rateBySrc map[string]float64
+}
+
+func (m metricsFake) GetRateAverage(ctx context.Context, metricName string, sumBy string, period string) (rate float64, warns service.Warnings, err error) {
+	rate = 1
+	return
+}
+
+func (m metricsFake) GetRelativeRateByLabel(ctx context.Context, rateSum float64, metricName string, key string, period string) (rateByKey map[string]float64, warns service.Warnings, err error) {
+	rateByKey = m.rateBySrc
+	return
+}
+
+type limitsFake struct {
+	delay time.Duration
+	lock  *sync.Mutex
+	set   map[string]int64
+}
+
+func (l limitsFake) GetRaw(ctx context.Context, groupId, userId string, subj model.Subject) (lim model.Limit, err error) {
+	select {
+	case <-time.After(l.delay):
+		err = limits.ErrNotFound
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	return
+}
+
+func (l limitsFake) Set(ctx context.Context, groupId, userId string, subj model.Subject, count int64, expires time.Time) (err error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.set[fmt.Sprintf("%s/%s", userId, subj)] = count
+	return
+}
+
+type resolverFake struct{}
+
+func (r resolverFake) Resolve(ctx context.Context, srcUrl string) (src source.Source, err error) {
+	src = source.Source{
+		Type:    source.TypeFeed,
+		GroupId: "group0",
+		UserId:  srcUrl,
+	}
+	return
+}
+
+func newTestController(rateBySrc map[string]float64, svcLimits limits.Service, parallelism uint32) Controller {
+	policies, _ := NewLimitPolicies(LimitBounds{MinHourly: 1, MinDaily: 10, MaxHourly: 100, MaxDaily: 1000}, config.LimitPolicyConfig{Name: LimitPolicyLinear})
+	return NewController(
+		svcLimits,
+		metricsFake{rateBySrc: rateBySrc},
+		policies,
+		time.Hour,
+		parallelism,
+		time.Second,
+		resolverFake{},
+		nil,
+		nil,
+		"default",
+		catalog.Metrics{},
+		time.Minute,
+		time.Hour,
+		slog.New(slog.NewTextHandler(io.Discard, nil)),
+	)
+}
+
+func TestController_SetMostReadLimits(t *testing.T) {
+	rateBySrc := make(map[string]float64)
+	for i := 0; i < 100; i++ {
+		rateBySrc[fmt.Sprintf("https://example.com/feed%d.xml", i)] = 0.01
+	}
+	cases := map[string]struct {
+		dryRun    bool
+		timeout   time.Duration
+		set       int
+		remaining bool
+	}{
+		"all": {
+			timeout: 10 * time.Second,
+			set:     200,
+		},
+		"dry run": {
+			dryRun:  true,
+			timeout: 10 * time.Second,
+		},
+		"partial on deadline": {
+			timeout:   deadlineReserve + 50*time.Millisecond,
+			remaining: true,
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			svcLimits := limitsFake{
+				delay: 10 * time.Millisecond,
+				lock:  &sync.Mutex{},
+				set:   make(map[string]int64),
+			}
+			ctrl := newTestController(rateBySrc, svcLimits, 10)
+			ctx, cancel := context.WithTimeout(context.TODO(), c.timeout)
+			defer cancel()
+			resp, err := ctrl.SetMostReadLimits(ctx, &SetMostReadLimitsRequest{
+				DryRun: c.dryRun,
+			})
+			assert.Nil(t, err)
+			assert.Equal(t, c.remaining, resp.Incomplete)
+			assert.Equal(t, len(rateBySrc), len(resp.Sources)+int(resp.SourcesRemaining))
+			switch c.remaining {
+			case true:
+				assert.Greater(t, resp.SourcesRemaining, int32(0))
+			default:
+				assert.Equal(t, c.set, len(svcLimits.set))
+				assert.Equal(t, c.set/2, len(resp.HourlyLimitBySource))
+				for _, sl := range resp.Sources {
+					assert.Equal(t, int64(2), sl.Hourly.Count)
+					assert.Equal(t, int64(20), sl.Daily.Count)
+				}
+			}
+		})
+	}
+}
+
+type resolverFailing struct {
+	err error
+}
+
+func (r resolverFailing) Resolve(ctx context.Context, srcUrl string) (src source.Source, err error) {
+	err = r.err
+	return
+}
+
+type activityPubCounting struct {
+	activitypub.Service
+	created *atomic.Int32
+}
+
+func (a activityPubCounting) Create(ctx context.Context, addr, groupId, userId string) (url string, err error) {
+	a.created.Add(1)
+	url = addr
+	return
+}
+
+func TestController_SetSourceLimits_ResolveFailure(t *testing.T) {
+	cases := map[string]struct {
+		err     error
+		created int32
+		typ     SourceType
+		errSl   string
+	}{
+		"not found creates the activitypub source": {
+			err:     fmt.Errorf("%w: https://example.com/feed.xml", source.ErrNotFound),
+			created: 1,
+			typ:     SourceType_Created,
+		},
+		"backend failure skips the source": {
+			err:   errors.New("unavailable"),
+			errSl: "failed to resolve the source: unavailable",
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			created := &atomic.Int32{}
+			ctrl := newTestController(nil, limitsFake{lock: &sync.Mutex{}, set: make(map[string]int64)}, 1).(controller)
+			ctrl.resolver = resolverFailing{err: c.err}
+			ctrl.svcAp = activityPubCounting{created: created}
+			sl := ctrl.setSourceLimits(context.TODO(), "https://example.com/feed.xml", LimitInput{RateRel: 0.01}, false)
+			assert.Equal(t, c.created, created.Load())
+			assert.Equal(t, c.typ, sl.Type)
+			assert.Equal(t, c.errSl, sl.Error)
+		})
+	}
+}
+
+func TestController_GetReadStatus(t *testing.T) {
+	rateBySrc := map[string]float64{
+		"https://example.com/feed0.xml": 0.25,
+		"https://example.com/feed1.xml": 0.75,
+	}
+	ctrl := newTestController(rateBySrc, nil, 1)
+	// no page requested: all the sources
+	resp, err := ctrl.GetReadStatus(context.TODO(), &GetReadStatusRequest{Period: "1h"})
+	assert.Nil(t, err)
+	assert.Equal(t, rateBySrc, resp.SourcesMostRead)
+	assert.Equal(t, 2, len(resp.Sources))
+	assert.Equal(t, "https://example.com/feed1.xml", resp.Sources[0].Source)
+	// the offset + limit would overflow
+	_, err = ctrl.GetReadStatus(context.TODO(), &GetReadStatusRequest{Period: "1h", Offset: math.MaxUint32, Limit: 10})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestController_GetTrendingInterests_InvalidPage(t *testing.T) {
+	ctrl := newTestController(nil, nil, 1)
+	_, err := ctrl.GetTrendingInterests(context.TODO(), &GetTrendingInterestsRequest{Offset: math.MaxUint32})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = ctrl.GetTrendingInterests(context.TODO(), &GetTrendingInterestsRequest{Limit: trendingLimitMax + 1})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
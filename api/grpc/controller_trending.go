@@ -0,0 +1,46 @@
+package grpc
+
+import (
+	"context"
+	"github.com/awakari/metrics/trending"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"time"
+)
+
+const trendingPeriodDefault = 24 * time.Hour
+const trendingLimitDefault = 10
+const trendingLimitMax = 1_000
+const trendingOffsetMax = 10_000
+
+func (c controller) GetTrendingInterests(ctx context.Context, req *GetTrendingInterestsRequest) (resp *GetTrendingInterestsResponse, err error) {
+	resp = &GetTrendingInterestsResponse{}
+	period := trendingPeriodDefault
+	if req.Period != "" {
+		period, err = trending.ParsePeriod(req.Period)
+	}
+	limit := req.Limit
+	switch {
+	case err != nil:
+	case req.Offset > trendingOffsetMax:
+		err = status.Errorf(codes.InvalidArgument, "offset should not be more than %d: %d", trendingOffsetMax, req.Offset)
+	case limit == 0:
+		limit = trendingLimitDefault
+	case limit > trendingLimitMax:
+		err = status.Errorf(codes.InvalidArgument, "limit should not be more than %d: %d", trendingLimitMax, limit)
+	}
+	if err == nil {
+		for _, g := range c.tracker.Trending(period, req.Offset, limit) {
+			resp.Interests = append(resp.Interests, &InterestGrowth{
+				Id:        g.Id,
+				Followers: g.Followers,
+				Delta:     g.Delta,
+				Rate:      g.Rate,
+				Since:     timestamppb.New(g.Since),
+			})
+		}
+	}
+	err = encodeError(err)
+	return
+}
@@ -0,0 +1,60 @@
+package grpc
+
+import (
+	"context"
+	"github.com/awakari/metrics/model"
+	"github.com/awakari/metrics/util"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"log/slog"
+	"time"
+)
+
+// newRequestInterceptor returns the interceptor assigning the request id and logging the call when it's done.
+// The request id is taken from the incoming "x-request-id" metadata when valid, otherwise it's generated.
+// It's returned in the response header and flows through the context into the logs and the outgoing calls.
+func newRequestInterceptor(log *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+		start := time.Now()
+		var id string
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if vals := md.Get(model.KeyRequestId); len(vals) > 0 {
+				id = vals[0]
+			}
+		}
+		if !util.ValidRequestId(id) {
+			id = util.NewRequestId()
+		}
+		ctx = util.WithRequestId(ctx, id)
+		_ = grpc.SetHeader(ctx, metadata.Pairs(model.KeyRequestId, id))
+		resp, err = handler(ctx, req)
+		code := status.Code(err)
+		lvl := slog.LevelDebug
+		switch code {
+		case codes.OK:
+		case codes.InvalidArgument, codes.NotFound, codes.Canceled:
+			lvl = slog.LevelWarn
+		default:
+			lvl = slog.LevelError
+		}
+		histServerDuration.WithLabelValues(info.FullMethod, code.String()).Observe(time.Since(start).Seconds())
+		log.Log(ctx, lvl, "grpc request", "method", info.FullMethod, "code", code.String(), "duration", time.Since(start), "err", err)
+		return
+	}
+}
+
+// NewClientRequestInterceptor returns the interceptor passing the request id from the context to the outgoing call
+// as the "x-request-id" metadata, so the downstream service logs may be correlated with this service ones.
+func NewClientRequestInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) (err error) {
+		if id := util.RequestId(ctx); id != "" {
+			if md, _ := metadata.FromOutgoingContext(ctx); len(md.Get(model.KeyRequestId)) == 0 {
+				ctx = metadata.AppendToOutgoingContext(ctx, model.KeyRequestId, id)
+			}
+		}
+		err = invoker(ctx, method, req, reply, cc, opts...)
+		return
+	}
+}
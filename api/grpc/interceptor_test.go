@@ -0,0 +1,43 @@
+package grpc
+
+import (
+	"context"
+	"github.com/awakari/metrics/model"
+	"github.com/awakari/metrics/util"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"testing"
+)
+
+func TestNewClientRequestInterceptor(t *testing.T) {
+	cases := map[string]struct {
+		ctx context.Context
+		ids []string
+	}{
+		"request id": {
+			ctx: util.WithRequestId(context.TODO(), "req0"),
+			ids: []string{"req0"},
+		},
+		"no request id": {
+			ctx: context.TODO(),
+		},
+		"already set": {
+			ctx: metadata.AppendToOutgoingContext(util.WithRequestId(context.TODO(), "req0"), model.KeyRequestId, "req1"),
+			ids: []string{"req1"},
+		},
+	}
+	interceptor := NewClientRequestInterceptor()
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			var ids []string
+			invoker := func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+				md, _ := metadata.FromOutgoingContext(ctx)
+				ids = md.Get(model.KeyRequestId)
+				return nil
+			}
+			assert.Nil(t, interceptor(c.ctx, "/svc/Method", nil, nil, nil, invoker))
+			assert.Equal(t, c.ids, ids)
+		})
+	}
+}
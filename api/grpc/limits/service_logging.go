@@ -2,7 +2,6 @@ package limits
 
 import (
 	"context"
-	"fmt"
 	"github.com/awakari/metrics/model"
 	"github.com/awakari/metrics/util"
 	"log/slog"
@@ -22,13 +21,15 @@ func NewServiceLogging(svc Service, log *slog.Logger) Service {
 }
 
 func (sl serviceLogging) GetRaw(ctx context.Context, groupId, userId string, subj model.Subject) (l model.Limit, err error) {
+	start := time.Now()
 	l, err = sl.svc.GetRaw(ctx, groupId, userId, subj)
-	sl.log.Log(ctx, util.LogLevel(err), fmt.Sprintf("limits.GetRaw(%s, %s, %s): %+v, err=%s", groupId, userId, subj, l, err))
+	sl.log.Log(ctx, util.LogLevel(err), "limits.GetRaw", "groupId", groupId, "userId", userId, "subject", subj, "limit", l, "duration", time.Since(start), "err", err)
 	return
 }
 
 func (sl serviceLogging) Set(ctx context.Context, groupId, userId string, subj model.Subject, count int64, expires time.Time) (err error) {
+	start := time.Now()
 	err = sl.svc.Set(ctx, groupId, userId, subj, count, expires)
-	sl.log.Log(ctx, util.LogLevel(err), fmt.Sprintf("limits.Set(%s, %s, %s, %d, %s): err=%s", groupId, userId, subj, count, expires, err))
+	sl.log.Log(ctx, util.LogLevel(err), "limits.Set", "groupId", groupId, "userId", userId, "subject", subj, "count", count, "expires", expires, "duration", time.Since(start), "err", err)
 	return
 }
@@ -0,0 +1,81 @@
+package grpc
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"strconv"
+	"time"
+)
+
+var histServerDuration = promauto.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "awk_metrics_grpc_request_duration_seconds",
+		Help:    "gRPC API request duration by the method and the response code",
+		Buckets: prometheus.DefBuckets,
+	},
+	[]string{"method", "code"},
+)
+
+var histClientDuration = promauto.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "awk_metrics_client_call_duration_seconds",
+		Help:    "Outgoing gRPC call duration by the downstream service, the method and the response code",
+		Buckets: prometheus.DefBuckets,
+	},
+	[]string{"service", "method", "code"},
+)
+
+var histLimitsRunDuration = promauto.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "awk_metrics_limits_run_duration_seconds",
+		Help:    "SetMostReadLimits run duration",
+		Buckets: []float64{1, 10, 30, 60, 120, 300, 600, 1200},
+	},
+	[]string{"dry_run", "incomplete"},
+)
+
+var counterLimitsSources = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "awk_metrics_limits_sources_total",
+		Help: "Sources processed by SetMostReadLimits by the result: ok, skipped or error",
+	},
+	[]string{"dry_run", "result"},
+)
+
+var counterLimits = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "awk_metrics_limits_total",
+		Help: "Source limits processed by SetMostReadLimits by the period and the action taken",
+	},
+	[]string{"dry_run", "period", "action"},
+)
+
+// NewClientMetricsInterceptor returns the interceptor observing the outgoing calls to the named downstream service.
+func NewClientMetricsInterceptor(service string) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) (err error) {
+		start := time.Now()
+		err = invoker(ctx, method, req, reply, cc, opts...)
+		histClientDuration.WithLabelValues(service, method, status.Code(err).String()).Observe(time.Since(start).Seconds())
+		return
+	}
+}
+
+func observeSourceLimits(sl *SourceLimits, dryRun bool) {
+	dr := strconv.FormatBool(dryRun)
+	result := "ok"
+	switch {
+	case sl.Error != "":
+		result = "error"
+	case sl.SkipReason != "":
+		result = "skipped"
+	}
+	counterLimitsSources.WithLabelValues(dr, result).Inc()
+	for period, l := range map[string]*Limit{"hourly": sl.Hourly, "daily": sl.Daily} {
+		if l != nil {
+			counterLimits.WithLabelValues(dr, period, l.Action.String()).Inc()
+		}
+	}
+}
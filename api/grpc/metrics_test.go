@@ -0,0 +1,36 @@
+package grpc
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestObserveSourceLimits(t *testing.T) {
+	counters := []prometheus.Counter{
+		counterLimitsSources.WithLabelValues("false", "ok"),
+		counterLimitsSources.WithLabelValues("false", "skipped"),
+		counterLimitsSources.WithLabelValues("true", "error"),
+		counterLimits.WithLabelValues("false", "hourly", "Set"),
+		counterLimits.WithLabelValues("false", "daily", "Kept"),
+	}
+	// the counters are global, other tests may increment these too
+	before := make([]float64, len(counters))
+	for i, c := range counters {
+		before[i] = testutil.ToFloat64(c)
+	}
+	observeSourceLimits(&SourceLimits{
+		Hourly: &Limit{Action: LimitAction_Set},
+		Daily:  &Limit{Action: LimitAction_Kept},
+	}, false)
+	observeSourceLimits(&SourceLimits{
+		SkipReason: "sharing the limit of src0",
+	}, false)
+	observeSourceLimits(&SourceLimits{
+		Error: "failed to resolve the source",
+	}, true)
+	for i, c := range counters {
+		assert.Equal(t, before[i]+1, testutil.ToFloat64(c))
+	}
+}
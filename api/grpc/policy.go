@@ -0,0 +1,188 @@
+package grpc
+
+import (
+	"errors"
+	"fmt"
+	"github.com/awakari/metrics/config"
+	"math"
+	"sort"
+	"strings"
+)
+
+// LimitPolicy computes the automatic publishing limits of the most read source.
+type LimitPolicy interface {
+	Limits(in LimitInput) (hourly, daily int64)
+}
+
+// LimitInput describes the source reading popularity.
+type LimitInput struct {
+	// RateRel is the source's share of the total read rate, (0, 1].
+	RateRel float64
+	// Rank is the source's percentile rank among the read sources, (0, 1], where 1 is the most read source.
+	Rank float64
+}
+
+// LimitBounds are the limits of the least (min) and the most (min + max) read source.
+type LimitBounds struct {
+	MinHourly int64
+	MinDaily  int64
+	MaxHourly int64
+	MaxDaily  int64
+}
+
+const (
+	LimitPolicyLinear      = "linear"
+	LimitPolicyLogarithmic = "logarithmic"
+	LimitPolicyTiered      = "tiered"
+	LimitPolicyPercentile  = "percentile"
+)
+
+var ErrInvalidLimitPolicy = errors.New("invalid limit policy")
+
+// share maps the source popularity to the (0, 1] share of the max limits.
+type share func(in LimitInput) float64
+
+type limitPolicy struct {
+	bounds LimitBounds
+	share  share
+}
+
+func (lp limitPolicy) Limits(in LimitInput) (hourly, daily int64) {
+	s := lp.share(in)
+	hourly = lp.bounds.MinHourly + int64(float64(lp.bounds.MaxHourly)*s)
+	daily = lp.bounds.MinDaily + int64(float64(lp.bounds.MaxDaily)*s)
+	return
+}
+
+func NewLimitPolicy(name string, bounds LimitBounds, cfg config.LimitPolicyConfig) (lp LimitPolicy, err error) {
+	var s share
+	switch name {
+	case LimitPolicyLinear:
+		s = shareLinear
+	case LimitPolicyLogarithmic:
+		s, err = newShareLogarithmic(cfg.LogScale)
+	case LimitPolicyTiered:
+		s, err = newShareTiered(cfg.Tiers)
+	case LimitPolicyPercentile:
+		s = sharePercentile
+	default:
+		err = fmt.Errorf("%w: unknown name %q", ErrInvalidLimitPolicy, name)
+	}
+	if err == nil {
+		lp = limitPolicy{
+			bounds: bounds,
+			share:  s,
+		}
+	}
+	return
+}
+
+// shareLinear is proportional to the source's share of reads.
+func shareLinear(in LimitInput) float64 {
+	return in.RateRel
+}
+
+// newShareLogarithmic favors the less read sources: log(1 + scale*rateRel) / log(1 + scale).
+func newShareLogarithmic(scale float64) (s share, err error) {
+	if scale <= 0 {
+		err = fmt.Errorf("%w: logarithmic scale should be positive: %f", ErrInvalidLimitPolicy, scale)
+		return
+	}
+	norm := math.Log1p(scale)
+	s = func(in LimitInput) float64 {
+		return math.Log1p(scale*in.RateRel) / norm
+	}
+	return
+}
+
+// newShareTiered returns the share of the highest tier which read rate threshold is reached by the source.
+func newShareTiered(tiers map[float64]float64) (s share, err error) {
+	if len(tiers) == 0 {
+		err = fmt.Errorf("%w: no tiers", ErrInvalidLimitPolicy)
+		return
+	}
+	thresholds := make([]float64, 0, len(tiers))
+	for t, v := range tiers {
+		if t < 0 || t > 1 || v < 0 || v > 1 {
+			err = fmt.Errorf("%w: tier %f:%f is out of [0, 1] bounds", ErrInvalidLimitPolicy, t, v)
+			return
+		}
+		thresholds = append(thresholds, t)
+	}
+	sort.Float64s(thresholds)
+	s = func(in LimitInput) (v float64) {
+		for _, t := range thresholds {
+			if in.RateRel < t {
+				break
+			}
+			v = tiers[t]
+		}
+		return
+	}
+	return
+}
+
+// sharePercentile depends only on the source's rank and not on the read rate magnitude.
+func sharePercentile(in LimitInput) float64 {
+	return in.Rank
+}
+
+// LimitPolicies selects the limit policy by the source type.
+type LimitPolicies struct {
+	Default LimitPolicy
+	ByType  map[SourceType]LimitPolicy
+}
+
+func NewLimitPolicies(bounds LimitBounds, cfg config.LimitPolicyConfig) (lps LimitPolicies, err error) {
+	lps.Default, err = NewLimitPolicy(cfg.Name, bounds, cfg)
+	lps.ByType = make(map[SourceType]LimitPolicy)
+	for typName, name := range cfg.ByType {
+		typ, ok := SourceType_value[sourceTypeNames[strings.ToLower(typName)]]
+		if !ok || typ == int32(SourceType_SourceTypeUndefined) {
+			err = errors.Join(err, fmt.Errorf("%w: unknown source type %q", ErrInvalidLimitPolicy, typName))
+			continue
+		}
+		lp, errType := NewLimitPolicy(name, bounds, cfg)
+		switch errType {
+		case nil:
+			lps.ByType[SourceType(typ)] = lp
+		default:
+			err = errors.Join(err, fmt.Errorf("source type %s: %w", typName, errType))
+		}
+	}
+	return
+}
+
+var sourceTypeNames = func() (names map[string]string) {
+	names = make(map[string]string)
+	for _, n := range SourceType_name {
+		names[strings.ToLower(n)] = n
+	}
+	return
+}()
+
+func (lps LimitPolicies) Of(typ SourceType) (lp LimitPolicy) {
+	lp, ok := lps.ByType[typ]
+	if !ok {
+		lp = lps.Default
+	}
+	return
+}
+
+// PercentileRanks returns the percentile rank of every key by its value: the fraction of the values less or equal.
+func PercentileRanks(vals map[string]float64) (ranks map[string]float64) {
+	ranks = make(map[string]float64, len(vals))
+	sorted := make([]float64, 0, len(vals))
+	for _, v := range vals {
+		sorted = append(sorted, v)
+	}
+	sort.Float64s(sorted)
+	n := float64(len(sorted))
+	for k, v := range vals {
+		le := sort.Search(len(sorted), func(i int) bool {
+			return sorted[i] > v
+		})
+		ranks[k] = float64(le) / n
+	}
+	return
+}
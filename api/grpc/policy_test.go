@@ -0,0 +1,117 @@
+package grpc
+
+import (
+	"github.com/awakari/metrics/config"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestNewLimitPolicy(t *testing.T) {
+	bounds := LimitBounds{
+		MinHourly: 10,
+		MinDaily:  100,
+		MaxHourly: 1000,
+		MaxDaily:  10000,
+	}
+	cfg := config.LimitPolicyConfig{
+		LogScale: 99,
+		Tiers: map[float64]float64{
+			0.01: 0.1,
+			0.1:  0.5,
+			0.5:  1,
+		},
+	}
+	cases := map[string]struct {
+		name   string
+		in     LimitInput
+		hourly int64
+		daily  int64
+		err    error
+	}{
+		"linear": {
+			name:   LimitPolicyLinear,
+			in:     LimitInput{RateRel: 0.25, Rank: 1},
+			hourly: 260,
+			daily:  2600,
+		},
+		"logarithmic": {
+			name:   LimitPolicyLogarithmic,
+			in:     LimitInput{RateRel: 1.0 / 11, Rank: 1}, // log(10) / log(100) = 0.5
+			hourly: 510,
+			daily:  5100,
+		},
+		"tiered below the lowest tier": {
+			name:   LimitPolicyTiered,
+			in:     LimitInput{RateRel: 0.001, Rank: 1},
+			hourly: 10,
+			daily:  100,
+		},
+		"tiered": {
+			name:   LimitPolicyTiered,
+			in:     LimitInput{RateRel: 0.2, Rank: 1},
+			hourly: 510,
+			daily:  5100,
+		},
+		"percentile": {
+			name:   LimitPolicyPercentile,
+			in:     LimitInput{RateRel: 0.001, Rank: 0.5},
+			hourly: 510,
+			daily:  5100,
+		},
+		"unknown": {
+			name: "fair",
+			err:  ErrInvalidLimitPolicy,
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			lp, err := NewLimitPolicy(c.name, bounds, cfg)
+			assert.ErrorIs(t, err, c.err)
+			if err == nil {
+				hourly, daily := lp.Limits(c.in)
+				assert.Equal(t, c.hourly, hourly)
+				assert.Equal(t, c.daily, daily)
+			}
+		})
+	}
+}
+
+func TestNewLimitPolicies(t *testing.T) {
+	bounds := LimitBounds{
+		MaxHourly: 100,
+	}
+	lps, err := NewLimitPolicies(bounds, config.LimitPolicyConfig{
+		Name: LimitPolicyLinear,
+		ByType: map[string]string{
+			"telegram": LimitPolicyPercentile,
+		},
+	})
+	assert.Nil(t, err)
+	in := LimitInput{RateRel: 0.1, Rank: 0.9}
+	hourly, _ := lps.Of(SourceType_Feed).Limits(in)
+	assert.Equal(t, int64(10), hourly)
+	hourly, _ = lps.Of(SourceType_Telegram).Limits(in)
+	assert.Equal(t, int64(90), hourly)
+	_, err = NewLimitPolicies(bounds, config.LimitPolicyConfig{
+		Name: LimitPolicyLinear,
+		ByType: map[string]string{
+			"mastodon": LimitPolicyPercentile,
+		},
+	})
+	assert.ErrorIs(t, err, ErrInvalidLimitPolicy)
+}
+
+func TestPercentileRanks(t *testing.T) {
+	ranks := PercentileRanks(map[string]float64{
+		"a": 0.5,
+		"b": 0.25,
+		"c": 0.125,
+		"d": 0.125,
+	})
+	assert.Equal(t, map[string]float64{
+		"a": 1,
+		"b": 0.75,
+		"c": 0.5,
+		"d": 0.5,
+	}, ranks)
+}
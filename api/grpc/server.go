@@ -1,50 +1,97 @@
 package grpc
 
 import (
+	"context"
 	"fmt"
-	"github.com/awakari/metrics/api/grpc/limits"
-	"github.com/awakari/metrics/api/grpc/source/activitypub"
-	"github.com/awakari/metrics/api/grpc/source/feeds"
-	"github.com/awakari/metrics/api/grpc/source/sites"
-	"github.com/awakari/metrics/api/grpc/source/telegram"
-	"github.com/awakari/metrics/config"
-	"github.com/awakari/metrics/service"
+	"github.com/awakari/metrics/health"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/health"
+	grpcHealth "google.golang.org/grpc/health"
 	"google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/reflection"
+	"log/slog"
 	"net"
 )
 
-func Serve(
-	cfg config.Config,
-	svcLimits limits.Service,
-	svcMetrics service.Service,
-	svcSrcFeeds feeds.Service,
-	svcSrcSites sites.Service,
-	svcSrcTg telegram.Service,
-	svcSrcAp activitypub.Service,
-) (err error) {
-	srv := grpc.NewServer()
-	controllerAdmin := NewController(
-		svcLimits,
-		svcMetrics,
-		cfg.Limits.Default.User.Publish.Hourly,
-		cfg.Limits.Default.User.Publish.Daily,
-		cfg.Limits.Max.User.Publish.Hourly,
-		cfg.Limits.Max.User.Publish.Daily,
-		svcSrcFeeds,
-		svcSrcSites,
-		svcSrcTg,
-		svcSrcAp,
-		cfg.Limits.Default.Groups[0],
+type Server interface {
+
+	// Serve blocks until the server is stopped.
+	Serve(port uint16) (err error)
+
+	// SetHealth reports the service and each dependency health status by its name.
+	// The whole server status, the one with the empty service name, is the same as the service one.
+	SetHealth(r health.Report)
+
+	// SetNotServing reports the NOT_SERVING health status, so the clients stop sending the new requests.
+	// The status can not be changed back after.
+	SetNotServing()
+
+	// Stop waits for the pending requests to complete until the ctx is done, then cancels these.
+	Stop(ctx context.Context) (err error)
+}
+
+type server struct {
+	srv    *grpc.Server
+	health *grpcHealth.Server
+}
+
+func NewServer(c Controller, log *slog.Logger) Server {
+	srv := grpc.NewServer(
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.UnaryInterceptor(newRequestInterceptor(log)),
 	)
-	RegisterServiceServer(srv, controllerAdmin)
+	RegisterServiceServer(srv, c)
 	reflection.Register(srv)
-	grpc_health_v1.RegisterHealthServer(srv, health.NewServer())
-	conn, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.Api.Port))
+	h := grpcHealth.NewServer()
+	// not ready until the dependencies are checked
+	h.SetServingStatus("", grpc_health_v1.HealthCheckResponse_NOT_SERVING)
+	h.SetServingStatus(Service_ServiceDesc.ServiceName, grpc_health_v1.HealthCheckResponse_NOT_SERVING)
+	grpc_health_v1.RegisterHealthServer(srv, h)
+	return server{
+		srv:    srv,
+		health: h,
+	}
+}
+
+func (s server) Serve(port uint16) (err error) {
+	conn, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
 	if err == nil {
-		err = srv.Serve(conn)
+		err = s.srv.Serve(conn)
+	}
+	return
+}
+
+func (s server) SetHealth(r health.Report) {
+	s.health.SetServingStatus("", servingStatus(r.Ready()))
+	s.health.SetServingStatus(Service_ServiceDesc.ServiceName, servingStatus(r.Ready()))
+	for _, d := range r.Dependencies {
+		s.health.SetServingStatus(d.Name, servingStatus(d.Status == health.StatusUp))
+	}
+}
+
+func servingStatus(ok bool) (st grpc_health_v1.HealthCheckResponse_ServingStatus) {
+	st = grpc_health_v1.HealthCheckResponse_NOT_SERVING
+	if ok {
+		st = grpc_health_v1.HealthCheckResponse_SERVING
+	}
+	return
+}
+
+func (s server) SetNotServing() {
+	s.health.Shutdown()
+}
+
+func (s server) Stop(ctx context.Context) (err error) {
+	stopped := make(chan struct{})
+	go func() {
+		s.srv.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		s.srv.Stop()
+		err = fmt.Errorf("pending requests cancelled: %w", ctx.Err())
 	}
 	return
 }
@@ -0,0 +1,46 @@
+package grpc
+
+import (
+	"context"
+	"github.com/awakari/metrics/health"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"io"
+	"log/slog"
+	"testing"
+)
+
+func TestServer_SetHealth(t *testing.T) {
+	s := NewServer(nil, slog.New(slog.NewTextHandler(io.Discard, nil))).(server)
+	check := func(name string) grpc_health_v1.HealthCheckResponse_ServingStatus {
+		resp, err := s.health.Check(context.TODO(), &grpc_health_v1.HealthCheckRequest{
+			Service: name,
+		})
+		assert.Nil(t, err)
+		return resp.GetStatus()
+	}
+	assert.Equal(t, grpc_health_v1.HealthCheckResponse_NOT_SERVING, check(""))
+	s.SetHealth(health.Report{
+		Status: health.StatusDegraded,
+		Dependencies: []health.Dependency{
+			{
+				Name:     "prometheus",
+				Required: true,
+				Status:   health.StatusUp,
+			},
+			{
+				Name:   "source-feeds",
+				Status: health.StatusDown,
+			},
+		},
+	})
+	assert.Equal(t, grpc_health_v1.HealthCheckResponse_SERVING, check(""))
+	assert.Equal(t, grpc_health_v1.HealthCheckResponse_SERVING, check(Service_ServiceDesc.ServiceName))
+	assert.Equal(t, grpc_health_v1.HealthCheckResponse_SERVING, check("prometheus"))
+	assert.Equal(t, grpc_health_v1.HealthCheckResponse_NOT_SERVING, check("source-feeds"))
+	s.SetNotServing()
+	s.SetHealth(health.Report{
+		Status: health.StatusUp,
+	})
+	assert.Equal(t, grpc_health_v1.HealthCheckResponse_NOT_SERVING, check(""))
+}
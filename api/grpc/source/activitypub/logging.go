@@ -2,9 +2,9 @@ package activitypub
 
 import (
     "context"
-    "fmt"
     "github.com/awakari/metrics/util"
     "log/slog"
+    "time"
 )
 
 type logging struct {
@@ -20,13 +20,15 @@ func NewLogging(svc Service, log *slog.Logger) Service {
 }
 
 func (l logging) Create(ctx context.Context, addr, groupId, userId string) (url string, err error) {
+    start := time.Now()
     url, err = l.svc.Create(ctx, addr, groupId, userId)
-    l.log.Log(ctx, util.LogLevel(err), fmt.Sprintf("activitypub.Create(addr=%s, groupId=%s, userId=%s): %s, %s", addr, groupId, userId, url, err))
+    l.log.Log(ctx, util.LogLevel(err), "activitypub.Create", "addr", addr, "groupId", groupId, "userId", userId, "url", url, "duration", time.Since(start), "err", err)
     return
 }
 
 func (l logging) Read(ctx context.Context, url string) (a *Source, err error) {
+    start := time.Now()
     a, err = l.svc.Read(ctx, url)
-    l.log.Log(ctx, util.LogLevel(err), fmt.Sprintf("activitypub.Read(url=%s): %+v, %s", url, a, err))
+    l.log.Log(ctx, util.LogLevel(err), "activitypub.Read", "url", url, "source", a, "duration", time.Since(start), "err", err)
     return
 }
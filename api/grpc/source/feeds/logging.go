@@ -2,9 +2,9 @@ package feeds
 
 import (
     "context"
-    "fmt"
     "github.com/awakari/metrics/util"
     "log/slog"
+    "time"
 )
 
 type serviceLogging struct {
@@ -20,7 +20,8 @@ func NewServiceLogging(svc Service, log *slog.Logger) Service {
 }
 
 func (sl serviceLogging) Read(ctx context.Context, url string) (feed *Feed, err error) {
+    start := time.Now()
     feed, err = sl.svc.Read(ctx, url)
-    sl.log.Log(ctx, util.LogLevel(err), fmt.Sprintf("feeds.Read(%s): err=%s", url, err))
+    sl.log.Log(ctx, util.LogLevel(err), "feeds.Read", "url", url, "duration", time.Since(start), "err", err)
     return
 }
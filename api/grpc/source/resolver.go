@@ -0,0 +1,303 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/awakari/metrics/api/grpc/source/activitypub"
+	"github.com/awakari/metrics/api/grpc/source/feeds"
+	"github.com/awakari/metrics/api/grpc/source/sites"
+	"github.com/awakari/metrics/api/grpc/source/telegram"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Resolver finds the source type and owner by the source URL.
+type Resolver interface {
+	Resolve(ctx context.Context, srcUrl string) (src Source, err error)
+}
+
+type Type int
+
+const (
+	TypeUndefined Type = iota
+	TypeFeed
+	TypeSite
+	TypeTelegram
+	TypeActivityPub
+)
+
+func (t Type) String() string {
+	switch t {
+	case TypeFeed:
+		return "feed"
+	case TypeSite:
+		return "site"
+	case TypeTelegram:
+		return "telegram"
+	case TypeActivityPub:
+		return "activitypub"
+	default:
+		return "undefined"
+	}
+}
+
+// Source is the resolved source.
+type Source struct {
+	Type    Type
+	GroupId string
+	UserId  string
+}
+
+const prefixSite = "site:"
+
+var ErrNotFound = errors.New("source not found")
+
+type resolver struct {
+	svcFeeds feeds.Service
+	svcSites sites.Service
+	svcTg    telegram.Service
+	svcAp    activitypub.Service
+	capacity int
+	ttl      time.Duration
+	lock     *sync.Mutex
+	cache    map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	src      Source
+	notFound bool
+	expires  time.Time
+}
+
+// ttlNotFoundMax limits the time to remember the source is not found, it may be created soon after.
+const ttlNotFoundMax = time.Minute
+
+// lookup reads the source from the single backend.
+// Returns ErrNotFound when the backend doesn't have the source.
+type lookup func(ctx context.Context, srcUrl string) (src Source, err error)
+
+// NewResolver returns the resolver remembering up to the capacity of the resolved sources for the ttl.
+// The sources not found are remembered too, for a minute at most, so the repeated lookups of the unknown ones don't reach the backends.
+func NewResolver(svcFeeds feeds.Service, svcSites sites.Service, svcTg telegram.Service, svcAp activitypub.Service, capacity uint32, ttl time.Duration) Resolver {
+	return resolver{
+		svcFeeds: svcFeeds,
+		svcSites: svcSites,
+		svcTg:    svcTg,
+		svcAp:    svcAp,
+		capacity: int(capacity),
+		ttl:      ttl,
+		lock:     &sync.Mutex{},
+		cache:    make(map[string]cacheEntry),
+	}
+}
+
+func (r resolver) Resolve(ctx context.Context, srcUrl string) (src Source, err error) {
+	e, ok := r.get(srcUrl)
+	switch {
+	case ok && e.notFound:
+		err = ErrNotFound
+		return
+	case ok:
+		src = e.src
+		return
+	}
+	first, rest := r.lookups(Classify(srcUrl))
+	if first != nil {
+		src, err = first(ctx, srcUrl)
+	}
+	if (first == nil || errors.Is(err, ErrNotFound)) && len(rest) > 0 {
+		src, err = r.lookupParallel(ctx, srcUrl, rest)
+	}
+	switch {
+	case err == nil:
+		r.put(srcUrl, cacheEntry{
+			src:     src,
+			expires: time.Now().Add(r.ttl),
+		})
+	case errors.Is(err, ErrNotFound):
+		r.put(srcUrl, cacheEntry{
+			notFound: true,
+			expires:  time.Now().Add(min(r.ttl, ttlNotFoundMax)),
+		})
+	}
+	return
+}
+
+func (r resolver) get(srcUrl string) (e cacheEntry, ok bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	e, ok = r.cache[srcUrl]
+	if ok && !e.expires.After(time.Now()) {
+		delete(r.cache, srcUrl)
+		ok = false
+	}
+	return
+}
+
+// put evicts the expired entries when the cache is full, then the one expiring first if it's still full.
+func (r resolver) put(srcUrl string, e cacheEntry) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if len(r.cache) >= r.capacity {
+		now := time.Now()
+		for k, e1 := range r.cache {
+			if !e1.expires.After(now) {
+				delete(r.cache, k)
+			}
+		}
+	}
+	if len(r.cache) >= r.capacity {
+		var kEvict string
+		var expiresEvict time.Time
+		for k, e1 := range r.cache {
+			if kEvict == "" || e1.expires.Before(expiresEvict) {
+				kEvict = k
+				expiresEvict = e1.expires
+			}
+		}
+		delete(r.cache, kEvict)
+	}
+	if r.capacity > 0 {
+		r.cache[srcUrl] = e
+	}
+}
+
+// Classify guesses the source type by the URL only.
+// Returns TypeUndefined when the URL alone is not enough to tell the type, e.g. for the most of feeds and fediverse actors.
+func Classify(srcUrl string) (t Type) {
+	if strings.HasPrefix(srcUrl, prefixSite) {
+		t = TypeSite
+		return
+	}
+	u, err := url.Parse(srcUrl)
+	if err != nil {
+		return
+	}
+	switch strings.TrimPrefix(strings.ToLower(u.Host), "www.") {
+	case "t.me", "telegram.me":
+		t = TypeTelegram
+	default:
+		switch {
+		case strings.HasPrefix(u.Path, "/@"), strings.HasPrefix(u.Path, "/users/"):
+			t = TypeActivityPub
+		}
+	}
+	return
+}
+
+// lookups returns the lookup of the classified type (if any) and the lookups to try in parallel otherwise.
+// Sites are looked up only by the "site:" prefixed URLs.
+func (r resolver) lookups(t Type) (first lookup, rest []lookup) {
+	if t == TypeSite {
+		first = r.lookupSite
+		return
+	}
+	for _, l := range []struct {
+		t Type
+		l lookup
+	}{
+		{TypeFeed, r.lookupFeed},
+		{TypeActivityPub, r.lookupActivityPub},
+		{TypeTelegram, r.lookupTelegram},
+	} {
+		switch l.t {
+		case t:
+			first = l.l
+		default:
+			rest = append(rest, l.l)
+		}
+	}
+	return
+}
+
+// lookupParallel returns the first found source and cancels the remaining lookups.
+func (r resolver) lookupParallel(ctx context.Context, srcUrl string, lookups []lookup) (src Source, err error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	type result struct {
+		src Source
+		err error
+	}
+	results := make(chan result, len(lookups))
+	for _, l := range lookups {
+		go func(l lookup) {
+			var res result
+			res.src, res.err = l(ctx, srcUrl)
+			results <- res
+		}(l)
+	}
+	var errs error
+	for range lookups {
+		res := <-results
+		if res.err == nil {
+			src = res.src
+			return
+		}
+		if !errors.Is(res.err, ErrNotFound) {
+			errs = errors.Join(errs, res.err)
+		}
+	}
+	switch errs {
+	case nil:
+		err = fmt.Errorf("%w: %s", ErrNotFound, srcUrl)
+	default:
+		err = errs
+	}
+	return
+}
+
+func (r resolver) lookupFeed(ctx context.Context, srcUrl string) (src Source, err error) {
+	var feed *feeds.Feed
+	feed, err = r.svcFeeds.Read(ctx, srcUrl)
+	if err == nil && feed != nil {
+		src = Source{Type: TypeFeed, GroupId: feed.GroupId, UserId: feed.UserId}
+	}
+	err = decodeError(TypeFeed, srcUrl, feed == nil, err)
+	return
+}
+
+func (r resolver) lookupSite(ctx context.Context, srcUrl string) (src Source, err error) {
+	var site *sites.Site
+	site, err = r.svcSites.Read(ctx, strings.TrimPrefix(srcUrl, prefixSite))
+	if err == nil && site != nil {
+		src = Source{Type: TypeSite, GroupId: site.GroupId, UserId: site.UserId}
+	}
+	err = decodeError(TypeSite, srcUrl, site == nil, err)
+	return
+}
+
+func (r resolver) lookupTelegram(ctx context.Context, srcUrl string) (src Source, err error) {
+	var ch *telegram.Channel
+	ch, err = r.svcTg.Read(ctx, srcUrl)
+	if err == nil && ch != nil {
+		src = Source{Type: TypeTelegram, GroupId: ch.GroupId, UserId: ch.UserId}
+	}
+	err = decodeError(TypeTelegram, srcUrl, ch == nil, err)
+	return
+}
+
+func (r resolver) lookupActivityPub(ctx context.Context, srcUrl string) (src Source, err error) {
+	var srcAp *activitypub.Source
+	srcAp, err = r.svcAp.Read(ctx, srcUrl)
+	if err == nil && srcAp != nil {
+		src = Source{Type: TypeActivityPub, GroupId: srcAp.GroupId, UserId: srcAp.UserId}
+	}
+	err = decodeError(TypeActivityPub, srcUrl, srcAp == nil, err)
+	return
+}
+
+func decodeError(t Type, srcUrl string, missing bool, src error) (dst error) {
+	switch {
+	case src == nil && !missing:
+	case src == nil, status.Code(src) == codes.NotFound:
+		dst = fmt.Errorf("%w: %s %s", ErrNotFound, t, srcUrl)
+	default:
+		dst = fmt.Errorf("failed to read the %s %s: %w", t, srcUrl, src)
+	}
+	return
+}
@@ -0,0 +1,194 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"github.com/awakari/metrics/api/grpc/source/activitypub"
+	"github.com/awakari/metrics/api/grpc/source/feeds"
+	"github.com/awakari/metrics/api/grpc/source/sites"
+	"github.com/awakari/metrics/api/grpc/source/telegram"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"maps"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var errNotFound = status.Error(codes.NotFound, "not found")
+
+type feedsFake map[string]*feeds.Feed
+
+func (f feedsFake) Read(ctx context.Context, url string) (feed *feeds.Feed, err error) {
+	feed, ok := f[url]
+	if !ok {
+		err = errNotFound
+	}
+	return
+}
+
+type sitesFake struct {
+	sites map[string]*sites.Site
+	calls *atomic.Int32
+}
+
+func (f sitesFake) Read(ctx context.Context, addr string) (site *sites.Site, err error) {
+	f.calls.Add(1)
+	site, ok := f.sites[addr]
+	if !ok {
+		err = errNotFound
+	}
+	return
+}
+
+type telegramFake map[string]*telegram.Channel
+
+func (f telegramFake) Read(ctx context.Context, link string) (ch *telegram.Channel, err error) {
+	switch link {
+	case "https://t.me/fail":
+		err = status.Error(codes.Unavailable, "unavailable")
+	default:
+		var ok bool
+		ch, ok = f[link]
+		if !ok {
+			err = errNotFound
+		}
+	}
+	return
+}
+
+type activityPubFake map[string]*activitypub.Source
+
+func (f activityPubFake) Create(ctx context.Context, addr, groupId, userId string) (url string, err error) {
+	err = errors.New("not implemented")
+	return
+}
+
+func (f activityPubFake) Read(ctx context.Context, url string) (src *activitypub.Source, err error) {
+	src, ok := f[url]
+	if !ok {
+		err = errNotFound
+	}
+	return
+}
+
+func TestResolver_Resolve(t *testing.T) {
+	calls := &atomic.Int32{}
+	r := NewResolver(
+		feedsFake{
+			"https://example.com/feed.xml": {GroupId: "group0", UserId: "https://example.com/feed.xml"},
+		},
+		sitesFake{
+			sites: map[string]*sites.Site{
+				"example.com": {GroupId: "group0", UserId: "user0"},
+			},
+			calls: calls,
+		},
+		telegramFake{
+			"https://t.me/channel0": {GroupId: "group1", UserId: "https://t.me/channel0"},
+		},
+		activityPubFake{
+			"https://mastodon.social/@user1": {GroupId: "group2", UserId: "https://mastodon.social/@user1"},
+			"https://t.me/fediverse":         {GroupId: "group2", UserId: "https://t.me/fediverse"},
+		},
+		10,
+		time.Minute,
+	)
+	cases := map[string]struct {
+		src Source
+		err error
+	}{
+		"https://example.com/feed.xml": {
+			src: Source{Type: TypeFeed, GroupId: "group0", UserId: "https://example.com/feed.xml"},
+		},
+		"site:example.com": {
+			src: Source{Type: TypeSite, GroupId: "group0", UserId: "user0"},
+		},
+		"https://t.me/channel0": {
+			src: Source{Type: TypeTelegram, GroupId: "group1", UserId: "https://t.me/channel0"},
+		},
+		"https://mastodon.social/@user1": {
+			src: Source{Type: TypeActivityPub, GroupId: "group2", UserId: "https://mastodon.social/@user1"},
+		},
+		"misclassified falls back to the others": {
+			src: Source{Type: TypeActivityPub, GroupId: "group2", UserId: "https://t.me/fediverse"},
+		},
+		"https://example.com/missing.xml": {
+			err: ErrNotFound,
+		},
+		"site:missing.com": {
+			err: ErrNotFound,
+		},
+		"site": {
+			err: ErrNotFound,
+		},
+		"https://t.me/fail": {
+			err: errNotFound,
+		},
+	}
+	urls := map[string]string{
+		"misclassified falls back to the others": "https://t.me/fediverse",
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			srcUrl, ok := urls[k]
+			if !ok {
+				srcUrl = k
+			}
+			src, err := r.Resolve(context.TODO(), srcUrl)
+			assert.Equal(t, c.src, src)
+			switch c.err {
+			case nil:
+				assert.Nil(t, err)
+			case errNotFound:
+				assert.NotNil(t, err)
+				assert.NotErrorIs(t, err, ErrNotFound)
+			default:
+				assert.ErrorIs(t, err, c.err)
+			}
+		})
+	}
+	// the non-site sources are never looked up as sites
+	assert.Equal(t, int32(2), calls.Load())
+	// the resolved source is cached
+	_, err := r.Resolve(context.TODO(), "site:example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, int32(2), calls.Load())
+	// the source not found is cached too
+	_, err = r.Resolve(context.TODO(), "site:missing.com")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestClassify(t *testing.T) {
+	cases := map[string]Type{
+		"site:example.com":               TypeSite,
+		"https://t.me/channel0":          TypeTelegram,
+		"https://telegram.me/channel0":   TypeTelegram,
+		"https://mastodon.social/@user1": TypeActivityPub,
+		"https://example.com/users/u":    TypeActivityPub,
+		"https://example.com/feed.xml":   TypeUndefined,
+		"site":                           TypeUndefined,
+		"":                               TypeUndefined,
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			assert.Equal(t, c, Classify(k))
+		})
+	}
+}
+
+func TestResolver_Put(t *testing.T) {
+	r := NewResolver(nil, nil, nil, nil, 2, time.Minute).(resolver)
+	now := time.Now()
+	r.put("expired", cacheEntry{expires: now.Add(-time.Second)})
+	r.put("src0", cacheEntry{expires: now.Add(time.Hour)})
+	r.put("src1", cacheEntry{expires: now.Add(time.Minute)})
+	assert.ElementsMatch(t, []string{"src0", "src1"}, slices.Collect(maps.Keys(r.cache)))
+	r.put("src2", cacheEntry{expires: now.Add(time.Hour)})
+	assert.ElementsMatch(t, []string{"src0", "src2"}, slices.Collect(maps.Keys(r.cache)))
+	_, ok := r.get("expired")
+	assert.False(t, ok)
+}
@@ -2,9 +2,9 @@ package sites
 
 import (
     "context"
-    "fmt"
     "github.com/awakari/metrics/util"
     "log/slog"
+    "time"
 )
 
 type serviceLogging struct {
@@ -20,7 +20,8 @@ func NewServiceLogging(svc Service, log *slog.Logger) Service {
 }
 
 func (sl serviceLogging) Read(ctx context.Context, addr string) (site *Site, err error) {
+    start := time.Now()
     site, err = sl.svc.Read(ctx, addr)
-    sl.log.Log(ctx, util.LogLevel(err), fmt.Sprintf("sites.Read(%s): site=%+v, err=%s", addr, site, err))
+    sl.log.Log(ctx, util.LogLevel(err), "sites.Read", "addr", addr, "site", site, "duration", time.Since(start), "err", err)
     return
 }
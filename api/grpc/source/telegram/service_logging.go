@@ -2,9 +2,9 @@ package telegram
 
 import (
     "context"
-    "fmt"
     "github.com/awakari/metrics/util"
     "log/slog"
+    "time"
 )
 
 type serviceLogging struct {
@@ -20,7 +20,8 @@ func NewServiceLogging(svc Service, log *slog.Logger) Service {
 }
 
 func (sl serviceLogging) Read(ctx context.Context, link string) (ch *Channel, err error) {
+    start := time.Now()
     ch, err = sl.svc.Read(ctx, link)
-    sl.log.Log(ctx, util.LogLevel(err), fmt.Sprintf("grpc.source.telegram.Read(%s): %+v, %s", link, ch, err))
+    sl.log.Log(ctx, util.LogLevel(err), "telegram.Read", "link", link, "channel", ch, "duration", time.Since(start), "err", err)
     return
 }
@@ -0,0 +1,29 @@
+package anomaly
+
+import (
+	"github.com/awakari/metrics/anomaly"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"time"
+)
+
+// Handler serves the last rate anomaly detection report.
+type Handler interface {
+	Get(ctx *gin.Context)
+}
+
+type handler struct {
+	detector anomaly.Detector
+}
+
+func NewHandler(detector anomaly.Detector) Handler {
+	return handler{
+		detector: detector,
+	}
+}
+
+func (h handler) Get(ctx *gin.Context) {
+	ctx.Header("Cache-Control", "max-age=60, public")
+	ctx.Header("Date", time.Now().Format(http.TimeFormat))
+	ctx.JSON(http.StatusOK, h.detector.Report())
+}
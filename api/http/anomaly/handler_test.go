@@ -0,0 +1,83 @@
+package anomaly
+
+import (
+	"github.com/awakari/metrics/anomaly"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type detectorFake struct {
+	anomaly.Detector
+	report anomaly.Report
+}
+
+func (d detectorFake) Report() anomaly.Report {
+	return d.report
+}
+
+func TestHandler_Get(t *testing.T) {
+	ts := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	cases := map[string]struct {
+		report anomaly.Report
+		body   string
+	}{
+		"anomalies": {
+			report: anomaly.Report{
+				Time: ts,
+				Anomalies: []anomaly.Rate{
+					{
+						Name:      "publish",
+						Metric:    "awk_published_events_count",
+						Value:     1,
+						Baseline:  10,
+						Stddev:    0.5,
+						Samples:   4,
+						Change:    -0.9,
+						Score:     -18,
+						Direction: anomaly.DirectionDrop,
+					},
+				},
+			},
+			body: `{
+				"time": "2026-10-18T12:00:00Z",
+				"anomalies": [
+					{
+						"name": "publish",
+						"metric": "awk_published_events_count",
+						"value": 1,
+						"baseline": 10,
+						"stddev": 0.5,
+						"samples": 4,
+						"change": -0.9,
+						"score": -18,
+						"direction": "drop"
+					}
+				]
+			}`,
+		},
+		"error": {
+			report: anomaly.Report{
+				Time:      ts,
+				Anomalies: []anomaly.Rate{},
+				Error:     "read: unavailable",
+			},
+			body: `{"time":"2026-10-18T12:00:00Z","anomalies":[],"error":"read: unavailable"}`,
+		},
+	}
+	gin.SetMode(gin.TestMode)
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			r := gin.New()
+			r.GET("/v1/anomalies", NewHandler(detectorFake{report: c.report}).Get)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/anomalies", nil))
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.JSONEq(t, c.body, w.Body.String())
+			assert.Equal(t, "max-age=60, public", w.Header().Get("Cache-Control"))
+		})
+	}
+}
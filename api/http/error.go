@@ -0,0 +1,48 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"github.com/awakari/metrics/promql"
+	"github.com/awakari/metrics/service"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+const HeaderWarning = "Warning"
+
+// StatusClientClosedRequest is the non-standard status of the request the client has gone before the response.
+const StatusClientClosedRequest = 499
+
+// RespondError aborts the request with the status code corresponding to the error and the JSON error body.
+func RespondError(ctx *gin.Context, err error) {
+	var code int
+	switch {
+	case errors.Is(err, service.ErrBadQuery), errors.Is(err, ErrInvalidSeriesRange), errors.Is(err, ErrInvalidPage), errors.Is(err, promql.ErrInvalid):
+		code = http.StatusBadRequest
+	case errors.Is(err, service.ErrEmptyResult):
+		code = http.StatusNotFound
+	case errors.Is(err, service.ErrTimeout):
+		code = http.StatusGatewayTimeout
+	case errors.Is(err, service.ErrCanceled):
+		code = StatusClientClosedRequest
+	case errors.Is(err, service.ErrUnavailable):
+		code = http.StatusBadGateway
+	default:
+		code = http.StatusInternalServerError
+	}
+	ctx.AbortWithStatusJSON(code, ErrorResponse{
+		Error: err.Error(),
+	})
+}
+
+// SetWarnings attaches the Prometheus query warnings to the response as the standard "Warning" headers.
+func SetWarnings(ctx *gin.Context, warns service.Warnings) {
+	for _, w := range warns {
+		ctx.Writer.Header().Add(HeaderWarning, fmt.Sprintf("199 metrics %q", w))
+	}
+}
@@ -0,0 +1,53 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/awakari/metrics/service"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRespondError(t *testing.T) {
+	cases := map[string]struct {
+		err  error
+		code int
+	}{
+		"bad query": {
+			err:  service.ErrBadQuery,
+			code: http.StatusBadRequest,
+		},
+		"empty": {
+			err:  service.ErrEmptyResult,
+			code: http.StatusNotFound,
+		},
+		"timeout": {
+			err:  fmt.Errorf("%w: %s", service.ErrTimeout, context.DeadlineExceeded),
+			code: http.StatusGatewayTimeout,
+		},
+		"canceled": {
+			err:  fmt.Errorf("%w: %s", service.ErrCanceled, context.Canceled),
+			code: StatusClientClosedRequest,
+		},
+		"unavailable": {
+			err:  service.ErrUnavailable,
+			code: http.StatusBadGateway,
+		},
+		"other": {
+			err:  errors.New("fail"),
+			code: http.StatusInternalServerError,
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(w)
+			RespondError(ctx, c.err)
+			assert.Equal(t, c.code, w.Code)
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package health
+
+import (
+	"github.com/awakari/metrics/health"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// Handler serves the latest dependency checks report.
+type Handler interface {
+
+	// Live responds OK while the process is running, the dependencies don't affect it.
+	Live(ctx *gin.Context)
+
+	// Ready responds OK when all the required dependencies are up, even when some optional ones are down.
+	Ready(ctx *gin.Context)
+}
+
+type handler struct {
+	checker health.Checker
+}
+
+func NewHandler(checker health.Checker) Handler {
+	return handler{
+		checker: checker,
+	}
+}
+
+func (h handler) Live(ctx *gin.Context) {
+	ctx.Header("Cache-Control", "no-store")
+	ctx.JSON(http.StatusOK, h.checker.Report())
+}
+
+func (h handler) Ready(ctx *gin.Context) {
+	ctx.Header("Cache-Control", "no-store")
+	r := h.checker.Report()
+	code := http.StatusOK
+	if !r.Ready() {
+		code = http.StatusServiceUnavailable
+	}
+	ctx.JSON(code, r)
+}
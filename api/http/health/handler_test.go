@@ -0,0 +1,99 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/awakari/metrics/health"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func probe(err error) health.Probe {
+	return func(ctx context.Context) (detail string, errProbe error) {
+		errProbe = err
+		return
+	}
+}
+
+func TestHandler(t *testing.T) {
+	errDown := errors.New("connection refused")
+	cases := map[string]struct {
+		down   map[string]bool
+		status health.Status
+		code   int
+	}{
+		"all up": {
+			status: health.StatusUp,
+			code:   http.StatusOK,
+		},
+		"prometheus down": {
+			down:   map[string]bool{"prometheus": true},
+			status: health.StatusDegraded,
+			code:   http.StatusOK,
+		},
+		"interests down": {
+			down:   map[string]bool{"interests": true},
+			status: health.StatusDown,
+			code:   http.StatusServiceUnavailable,
+		},
+		"usage down": {
+			down:   map[string]bool{"usage": true, "prometheus": true},
+			status: health.StatusDown,
+			code:   http.StatusServiceUnavailable,
+		},
+	}
+	gin.SetMode(gin.TestMode)
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			var checks []health.Check
+			for _, name := range []string{"prometheus", "interests", "usage"} {
+				var err error
+				if c.down[name] {
+					err = errDown
+				}
+				checks = append(checks, health.Check{
+					Name:     name,
+					Required: name != "prometheus",
+					Probe:    probe(err),
+				})
+			}
+			checker := health.NewChecker(checks, health.Config{Interval: time.Minute, Timeout: time.Second}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			h := NewHandler(checker)
+			r := gin.New()
+			r.GET("/healthz", h.Live)
+			r.GET("/readyz", h.Ready)
+			// not ready before the first check
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+			checker.Check(context.TODO())
+			w = httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			assert.Equal(t, c.code, w.Code)
+			assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+			var report health.Report
+			assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &report))
+			assert.Equal(t, c.status, report.Status)
+			assert.Equal(t, 3, len(report.Dependencies))
+			for _, d := range report.Dependencies {
+				if c.down[d.Name] {
+					assert.Equal(t, health.StatusDown, d.Status)
+					assert.Equal(t, errDown.Error(), d.Error)
+				} else {
+					assert.Equal(t, health.StatusUp, d.Status)
+				}
+			}
+			// live regardless of the dependencies
+			w = httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+			assert.Equal(t, http.StatusOK, w.Code)
+		})
+	}
+}
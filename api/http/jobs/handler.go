@@ -0,0 +1,36 @@
+package jobs
+
+import (
+	"encoding/json"
+	"github.com/awakari/metrics/scheduler"
+	"net/http"
+)
+
+// Handler returns the scheduled jobs status. It's not exposed publicly, only on the internal port.
+type Handler interface {
+	http.Handler
+}
+
+type handler struct {
+	sched scheduler.Scheduler
+}
+
+func NewHandler(sched scheduler.Scheduler) Handler {
+	return handler{
+		sched: sched,
+	}
+}
+
+func (h handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	statuses := h.sched.Status()
+	if statuses == nil {
+		statuses = []scheduler.JobStatus{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(statuses)
+}
@@ -0,0 +1,334 @@
+package leaderboard
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"github.com/awakari/metrics/api/grpc/auth"
+	apiGrpcInterests "github.com/awakari/metrics/api/grpc/interests"
+	apiHttp "github.com/awakari/metrics/api/http"
+	"github.com/awakari/metrics/condition"
+	"github.com/awakari/metrics/service"
+	"github.com/awakari/metrics/trending"
+	"github.com/awakari/metrics/util"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"math"
+	"net/http"
+	"time"
+)
+
+// Handler serves the public interests leaderboards:
+//
+//	/v1/public/interests/top?limit=10&cursor=...
+//	/v1/public/interests/new?limit=10&cursor=...
+//	/v1/public/interests/trending?period=1d&limit=10&offset=0
+//
+// The "cursor" is the opaque value returned by the previous page. Non-public interests are filtered out,
+// so a page may contain fewer interests than the limit while the next one is still available.
+// The trending interests are ranked by the followers growth over the "period": 1h, 1d or 1w.
+//
+// The legacy routes return the first page only, as the map of the interests by id:
+//
+//	/v1/public/top-interests?limit=10
+//	/v1/public/new-interests?limit=10
+//
+// The map loses the interests order, but its shape is kept on purpose, as the existing clients rely on it.
+// The legacy responses point to the ordered routes above with the "Deprecation" and "Link" headers.
+type Handler interface {
+	GetTop(ctx *gin.Context)
+	GetNew(ctx *gin.Context)
+	GetTrending(ctx *gin.Context)
+	GetTopLegacy(ctx *gin.Context)
+	GetNewLegacy(ctx *gin.Context)
+}
+
+type Interest struct {
+	Id          string     `json:"id"`
+	Description string     `json:"description"`
+	Enabled     bool       `json:"enabled"`
+	Followers   int64      `json:"followers"`
+	Created     *time.Time `json:"created,omitempty"`
+	Updated     *time.Time `json:"updated,omitempty"`
+	Expires     *time.Time `json:"expires,omitempty"`
+	// Condition is the readable expression of what the interest matches, see the condition.Render.
+	Condition     string          `json:"condition"`
+	ConditionTree *condition.Node `json:"conditionTree,omitempty"`
+	// Growth is set for the trending interests only.
+	Growth *Growth `json:"growth,omitempty"`
+}
+
+type Growth struct {
+	Delta int64 `json:"delta"`
+	// Rate is the followers gained per hour.
+	Rate  float64   `json:"rate"`
+	Since time.Time `json:"since"`
+}
+
+type Page struct {
+	Interests []Interest `json:"interests"`
+	// Cursor is empty when there are no more interests.
+	Cursor string `json:"cursor,omitempty"`
+}
+
+type handler struct {
+	clientInterests apiGrpcInterests.ServiceClient
+	tracker         trending.Tracker
+	groupIdDefault  string
+	readParallelism uint32
+	readTimeout     time.Duration
+}
+
+const cursorIdMax = "zzzzzzzz-zzzz-zzzz-zzzz-zzzzzzzzzzzz"
+
+const trendingPeriodDefault = "1d"
+
+func NewHandler(
+	clientInterests apiGrpcInterests.ServiceClient,
+	tracker trending.Tracker,
+	groupIdDefault string,
+	readParallelism uint32,
+	readTimeout time.Duration,
+) Handler {
+	return handler{
+		clientInterests: clientInterests,
+		tracker:         tracker,
+		groupIdDefault:  groupIdDefault,
+		readParallelism: readParallelism,
+		readTimeout:     readTimeout,
+	}
+}
+
+func (h handler) GetTop(ctx *gin.Context) {
+	h.getPage(ctx, apiGrpcInterests.Sort_FOLLOWERS, cursorTop())
+}
+
+func (h handler) GetNew(ctx *gin.Context) {
+	h.getPage(ctx, apiGrpcInterests.Sort_TIME_CREATED, cursorNew())
+}
+
+func (h handler) GetTopLegacy(ctx *gin.Context) {
+	h.getLegacy(ctx, apiGrpcInterests.Sort_FOLLOWERS, cursorTop(), "/v1/public/interests/top")
+}
+
+func (h handler) GetNewLegacy(ctx *gin.Context) {
+	h.getLegacy(ctx, apiGrpcInterests.Sort_TIME_CREATED, cursorNew(), "/v1/public/interests/new")
+}
+
+func cursorTop() *apiGrpcInterests.Cursor {
+	return &apiGrpcInterests.Cursor{
+		Id:        cursorIdMax,
+		Followers: math.MaxInt64,
+	}
+}
+
+func cursorNew() *apiGrpcInterests.Cursor {
+	return &apiGrpcInterests.Cursor{
+		Id:          cursorIdMax,
+		TimeCreated: timestamppb.New(time.Now().UTC()),
+	}
+}
+
+func (h handler) GetTrending(ctx *gin.Context) {
+	page, err := apiHttp.ParsePage(ctx)
+	var period time.Duration
+	if err == nil {
+		period, err = trending.ParsePeriod(ctx.DefaultQuery("period", trendingPeriodDefault))
+	}
+	if err != nil {
+		apiHttp.RespondError(ctx, err)
+		return
+	}
+	growths := h.tracker.Trending(period, page.Offset, page.Limit)
+	ids := make([]string, len(growths))
+	for i, g := range growths {
+		ids[i] = g.Id
+	}
+	ctxSubs := auth.SetOutgoingAuthInfo(ctx, h.groupIdDefault, "metrics")
+	results := h.read(ctxSubs, ids)
+	list := []Interest{}
+	var warns service.Warnings
+	for i, r := range results {
+		switch {
+		case r.Err != nil:
+			warns = append(warns, fmt.Sprintf("failed to read the interest %s: %s", ids[i], r.Err))
+		case r.Out.Public:
+			interest := newInterest(ids[i], r.Out)
+			interest.Growth = &Growth{
+				Delta: growths[i].Delta,
+				Rate:  growths[i].Rate,
+				Since: growths[i].Since,
+			}
+			list = append(list, interest)
+		}
+	}
+	respond(ctx, warns, Page{
+		Interests: list,
+	})
+}
+
+func (h handler) getPage(ctx *gin.Context, sort apiGrpcInterests.Sort, cursor *apiGrpcInterests.Cursor) {
+	limit, err := apiHttp.ParseLimit(ctx)
+	if err == nil {
+		err = decodeCursor(ctx.Query("cursor"), cursor)
+	}
+	if err != nil {
+		apiHttp.RespondError(ctx, err)
+		return
+	}
+	ctxSubs := auth.SetOutgoingAuthInfo(ctx, h.groupIdDefault, "metrics")
+	list, next, warns, err := h.search(ctxSubs, &apiGrpcInterests.SearchRequest{
+		Cursor: cursor,
+		Limit:  limit,
+		Order:  apiGrpcInterests.Order_DESC,
+		Sort:   sort,
+	})
+	if err != nil {
+		apiHttp.RespondError(ctx, err)
+		return
+	}
+	p := Page{
+		Interests: list,
+	}
+	if next != nil {
+		p.Cursor = encodeCursor(next)
+	}
+	respond(ctx, warns, p)
+}
+
+// getLegacy responds with the first page of the public interests by their ids, the shape the existing clients expect.
+// The followers are set for the top interests, the creation time is set for the new ones.
+// The successor is the route serving the same interests as the ordered list.
+func (h handler) getLegacy(ctx *gin.Context, sort apiGrpcInterests.Sort, cursor *apiGrpcInterests.Cursor, successor string) {
+	limit, err := apiHttp.ParseLimit(ctx)
+	if err != nil {
+		apiHttp.RespondError(ctx, err)
+		return
+	}
+	ctxSubs := auth.SetOutgoingAuthInfo(ctx, h.groupIdDefault, "metrics")
+	list, _, warns, err := h.search(ctxSubs, &apiGrpcInterests.SearchRequest{
+		Cursor: cursor,
+		Limit:  limit,
+		Order:  apiGrpcInterests.Order_DESC,
+		Sort:   sort,
+	})
+	if err != nil {
+		apiHttp.RespondError(ctx, err)
+		return
+	}
+	interestById := make(map[string]*apiGrpcInterests.ReadResponse, len(list))
+	for _, interest := range list {
+		legacy := &apiGrpcInterests.ReadResponse{
+			Description: interest.Description,
+		}
+		switch {
+		case sort == apiGrpcInterests.Sort_TIME_CREATED && interest.Created != nil:
+			legacy.Created = timestamppb.New(*interest.Created)
+		case sort != apiGrpcInterests.Sort_TIME_CREATED:
+			legacy.Followers = interest.Followers
+		}
+		interestById[interest.Id] = legacy
+	}
+	apiHttp.SetWarnings(ctx, warns)
+	ctx.Header("Deprecation", "true")
+	ctx.Header("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", successor))
+	ctx.Header("Cache-Control", "max-age=300, public")
+	ctx.Header("Date", time.Now().Format(http.TimeFormat))
+	ctx.JSON(http.StatusOK, interestById)
+}
+
+// search returns the public interests found in the search order and the cursor of the next page, nil if it's the last one.
+// The interests failed to read are skipped and reported in the warnings.
+// The full page always has the next page cursor, so it fails when none of its interests is read.
+func (h handler) search(ctx context.Context, req *apiGrpcInterests.SearchRequest) (list []Interest, next *apiGrpcInterests.Cursor, warns service.Warnings, err error) {
+	var resp *apiGrpcInterests.SearchResponse
+	resp, err = h.clientInterests.Search(ctx, req)
+	if err != nil {
+		return
+	}
+	results := h.read(ctx, resp.Ids)
+	list = []Interest{}
+	for i, r := range results {
+		id := resp.Ids[i]
+		switch {
+		case r.Err != nil:
+			warns = append(warns, fmt.Sprintf("failed to read the interest %s: %s", id, r.Err))
+			continue
+		case r.Out.Public:
+			list = append(list, newInterest(id, r.Out))
+		}
+		// the last interest read defines the next page start, the failed ones after it are retried there
+		next = &apiGrpcInterests.Cursor{
+			Id:          id,
+			Followers:   r.Out.Followers,
+			TimeCreated: r.Out.Created,
+		}
+	}
+	switch {
+	case len(resp.Ids) < int(req.Limit), len(resp.Ids) == 0:
+		next = nil
+	case next == nil:
+		// the sort key of the last interest is unknown, so is the next page start
+		err = fmt.Errorf("%w: failed to read all the %d interests of the page", service.ErrUnavailable, len(resp.Ids))
+	}
+	return
+}
+
+func (h handler) read(ctx context.Context, ids []string) []util.Result[*apiGrpcInterests.ReadResponse] {
+	return util.FanOut(ctx, ids, int(h.readParallelism), h.readTimeout, func(ctx context.Context, id string) (*apiGrpcInterests.ReadResponse, error) {
+		return h.clientInterests.Read(ctx, &apiGrpcInterests.ReadRequest{
+			Id: id,
+		})
+	})
+}
+
+func newInterest(id string, resp *apiGrpcInterests.ReadResponse) Interest {
+	return Interest{
+		Id:            id,
+		Description:   resp.Description,
+		Enabled:       resp.Enabled,
+		Followers:     resp.Followers,
+		Created:       timeOf(resp.Created),
+		Updated:       timeOf(resp.Updated),
+		Expires:       timeOf(resp.Expires),
+		Condition:     condition.Render(resp.Cond),
+		ConditionTree: condition.Tree(resp.Cond),
+	}
+}
+
+func timeOf(ts *timestamppb.Timestamp) (t *time.Time) {
+	if ts != nil && (ts.Seconds != 0 || ts.Nanos != 0) {
+		v := ts.AsTime()
+		t = &v
+	}
+	return
+}
+
+func encodeCursor(c *apiGrpcInterests.Cursor) string {
+	data, _ := protojson.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor overwrites the default cursor when the encoded one is not empty.
+func decodeCursor(encoded string, c *apiGrpcInterests.Cursor) (err error) {
+	if encoded == "" {
+		return
+	}
+	var data []byte
+	data, err = base64.RawURLEncoding.DecodeString(encoded)
+	if err == nil {
+		err = protojson.Unmarshal(data, c)
+	}
+	if err != nil {
+		err = fmt.Errorf("%w: cursor: %s", apiHttp.ErrInvalidPage, err)
+	}
+	return
+}
+
+func respond(ctx *gin.Context, warns service.Warnings, p Page) {
+	apiHttp.SetWarnings(ctx, warns)
+	ctx.Header("Cache-Control", "max-age=300, public")
+	ctx.Header("Date", time.Now().Format(http.TimeFormat))
+	ctx.JSON(http.StatusOK, p)
+}
@@ -0,0 +1,230 @@
+package leaderboard
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	apiGrpcInterests "github.com/awakari/metrics/api/grpc/interests"
+	apiHttp "github.com/awakari/metrics/api/http"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type clientInterestsFake struct {
+	apiGrpcInterests.ServiceClient
+	// ids are sorted by followers desc, then by id desc
+	ids       []string
+	followers map[string]int64
+	private   map[string]bool
+}
+
+func (c clientInterestsFake) Search(ctx context.Context, req *apiGrpcInterests.SearchRequest, opts ...grpc.CallOption) (resp *apiGrpcInterests.SearchResponse, err error) {
+	resp = &apiGrpcInterests.SearchResponse{}
+	for _, id := range c.ids {
+		f := c.followers[id]
+		if f < req.Cursor.Followers || (f == req.Cursor.Followers && id < req.Cursor.Id) {
+			resp.Ids = append(resp.Ids, id)
+		}
+	}
+	resp.Ids = resp.Ids[:min(len(resp.Ids), int(req.Limit))]
+	return
+}
+
+func (c clientInterestsFake) Read(ctx context.Context, req *apiGrpcInterests.ReadRequest, opts ...grpc.CallOption) (resp *apiGrpcInterests.ReadResponse, err error) {
+	f, ok := c.followers[req.Id]
+	if !ok {
+		err = errors.New("not found")
+		return
+	}
+	resp = &apiGrpcInterests.ReadResponse{
+		Description: "interest " + req.Id,
+		Public:      !c.private[req.Id],
+		Followers:   f,
+		Cond: &apiGrpcInterests.Condition{
+			Cond: &apiGrpcInterests.Condition_Tc{
+				Tc: &apiGrpcInterests.TextCondition{
+					Term: req.Id,
+				},
+			},
+		},
+	}
+	return
+}
+
+// clientInterestsConcurrent completes the reads in the reverse order of the search results.
+type clientInterestsConcurrent struct {
+	apiGrpcInterests.ServiceClient
+	ids     []string
+	private map[string]bool
+	failing map[string]bool
+	running *atomic.Int32
+	maxSeen *atomic.Int32
+}
+
+func (c clientInterestsConcurrent) Search(ctx context.Context, req *apiGrpcInterests.SearchRequest, opts ...grpc.CallOption) (resp *apiGrpcInterests.SearchResponse, err error) {
+	resp = &apiGrpcInterests.SearchResponse{
+		Ids: c.ids[:min(len(c.ids), int(req.Limit))],
+	}
+	return
+}
+
+func (c clientInterestsConcurrent) Read(ctx context.Context, req *apiGrpcInterests.ReadRequest, opts ...grpc.CallOption) (resp *apiGrpcInterests.ReadResponse, err error) {
+	n := c.running.Add(1)
+	defer c.running.Add(-1)
+	for {
+		seen := c.maxSeen.Load()
+		if n <= seen || c.maxSeen.CompareAndSwap(seen, n) {
+			break
+		}
+	}
+	var pos int
+	for i, id := range c.ids {
+		if id == req.Id {
+			pos = i
+		}
+	}
+	time.Sleep(time.Duration(len(c.ids)-pos) * time.Millisecond)
+	if c.failing[req.Id] {
+		err = errors.New("fail")
+		return
+	}
+	resp = &apiGrpcInterests.ReadResponse{
+		Description: "interest " + req.Id,
+		Public:      !c.private[req.Id],
+		Followers:   int64(len(c.ids) - pos),
+		Created:     timestamppb.New(time.Date(2026, 1, pos+1, 0, 0, 0, 0, time.UTC)),
+	}
+	return
+}
+
+func TestHandler_GetTop(t *testing.T) {
+	client := clientInterestsFake{
+		ids: []string{"i0", "i2", "i1", "i4", "i3"},
+		followers: map[string]int64{
+			"i0": 5,
+			"i1": 4,
+			"i2": 4,
+			"i4": 1,
+		},
+		private: map[string]bool{
+			"i1": true,
+		},
+	}
+	h := NewHandler(client, nil, "group0", 2, time.Second)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/top", h.GetTop)
+	var ids []string
+	var warns []string
+	var cursor string
+	for i := 0; i < 5; i++ {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/top?limit=2&cursor="+cursor, nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+		warns = append(warns, w.Header().Values("Warning")...)
+		var p Page
+		assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &p))
+		for _, interest := range p.Interests {
+			ids = append(ids, interest.Id)
+			assert.Equal(t, `"`+interest.Id+`"`, interest.Condition)
+		}
+		cursor = p.Cursor
+		if cursor == "" {
+			break
+		}
+	}
+	// i1 is private, i3 fails to read
+	assert.Equal(t, []string{"i0", "i2", "i4"}, ids)
+	assert.Equal(t, 1, len(warns))
+	//
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/top?cursor=!!!", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestHandler_GetLegacy(t *testing.T) {
+	client := clientInterestsConcurrent{
+		ids: []string{"i0", "i1", "i2", "i3", "i4", "i5"},
+		private: map[string]bool{
+			"i2": true,
+		},
+		failing: map[string]bool{
+			"i3": true,
+		},
+		running: &atomic.Int32{},
+		maxSeen: &atomic.Int32{},
+	}
+	h := NewHandler(client, nil, "group0", 2, time.Second)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/top", h.GetTop)
+	r.GET("/top-interests", h.GetTopLegacy)
+	r.GET("/new-interests", h.GetNewLegacy)
+	// the reads complete in the reverse order, the search order is kept
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/top?limit=5", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{`199 metrics "failed to read the interest i3: fail"`}, w.Header().Values(apiHttp.HeaderWarning))
+	var p Page
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &p))
+	var ids []string
+	for _, interest := range p.Interests {
+		ids = append(ids, interest.Id)
+	}
+	assert.Equal(t, []string{"i0", "i1", "i4"}, ids)
+	assert.NotEmpty(t, p.Cursor)
+	assert.LessOrEqual(t, client.maxSeen.Load(), int32(2))
+	// the legacy shape: the public interests by id, the followers only
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/top-interests?limit=5", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{`199 metrics "failed to read the interest i3: fail"`}, w.Header().Values(apiHttp.HeaderWarning))
+	assert.JSONEq(t, `{
+		"i0": {"description": "interest i0", "followers": 6},
+		"i1": {"description": "interest i1", "followers": 5},
+		"i4": {"description": "interest i4", "followers": 2}
+	}`, w.Body.String())
+	assert.Equal(t, "true", w.Header().Get("Deprecation"))
+	assert.Equal(t, `</v1/public/interests/top>; rel="successor-version"`, w.Header().Get("Link"))
+	// the creation time only
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/new-interests?limit=2", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Values(apiHttp.HeaderWarning))
+	assert.JSONEq(t, `{
+		"i0": {"description": "interest i0", "created": {"seconds": 1767225600}},
+		"i1": {"description": "interest i1", "created": {"seconds": 1767312000}}
+	}`, w.Body.String())
+	assert.Equal(t, `</v1/public/interests/new>; rel="successor-version"`, w.Header().Get("Link"))
+}
+
+func TestHandler_GetTop_PageUnread(t *testing.T) {
+	client := clientInterestsFake{
+		ids: []string{"i0", "i1", "i2"},
+		followers: map[string]int64{
+			"i0": 3,
+		},
+	}
+	h := NewHandler(client, nil, "group0", 2, time.Second)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/top", h.GetTop)
+	// the last interest of the full page is not read, the cursor is the last one read
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/top?limit=2", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var p Page
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &p))
+	assert.NotEmpty(t, p.Cursor)
+	// none of the full page interests is read, the next page start is unknown
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/top?limit=2&cursor="+p.Cursor, nil))
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+}
@@ -0,0 +1,34 @@
+package http
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"strconv"
+	"time"
+)
+
+var histRequestDuration = promauto.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "awk_metrics_http_request_duration_seconds",
+		Help:    "HTTP API request duration by the route, the method and the response status",
+		Buckets: prometheus.DefBuckets,
+	},
+	[]string{"route", "method", "status"},
+)
+
+// routeUnmatched is the route label value for the requests not matching any route, to keep the label cardinality bounded.
+const routeUnmatched = "unmatched"
+
+// ObserveRequest is the middleware observing the request duration and the response status.
+func ObserveRequest(ctx *gin.Context) {
+	start := time.Now()
+	ctx.Next()
+	route := ctx.FullPath()
+	if route == "" {
+		route = routeUnmatched
+	}
+	histRequestDuration.
+		WithLabelValues(route, ctx.Request.Method, strconv.Itoa(ctx.Writer.Status())).
+		Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,50 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"strconv"
+)
+
+type Page struct {
+	Offset uint32
+	Limit  uint32
+}
+
+const pageLimitDefault = 10
+const pageLimitMax = 100
+const pageOffsetMax = 10_000
+
+var ErrInvalidPage = errors.New("invalid page")
+
+// ParsePage reads the optional "offset" and "limit" query parameters. By default, the first 10 items are selected.
+func ParsePage(ctx *gin.Context) (p Page, err error) {
+	p.Offset, err = parseQueryUint(ctx, "offset", 0, pageOffsetMax)
+	if err == nil {
+		p.Limit, err = ParseLimit(ctx)
+	}
+	return
+}
+
+// ParseLimit reads the optional "limit" query parameter, 10 by default.
+func ParseLimit(ctx *gin.Context) (limit uint32, err error) {
+	limit, err = parseQueryUint(ctx, "limit", pageLimitDefault, pageLimitMax)
+	return
+}
+
+func parseQueryUint(ctx *gin.Context, name string, dflt, max uint32) (n uint32, err error) {
+	n = dflt
+	v := ctx.Query(name)
+	if v == "" {
+		return
+	}
+	var n64 uint64
+	n64, err = strconv.ParseUint(v, 10, 32)
+	if err != nil || n64 > uint64(max) {
+		err = fmt.Errorf("%w: %s should be an integer in the range [0, %d]: %q", ErrInvalidPage, name, max, v)
+		return
+	}
+	n = uint32(n64)
+	return
+}
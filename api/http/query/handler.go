@@ -0,0 +1,65 @@
+package query
+
+import (
+	"fmt"
+	apiHttp "github.com/awakari/metrics/api/http"
+	"github.com/awakari/metrics/promql"
+	"github.com/awakari/metrics/service"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Handler serves the generic query for the whitelisted metrics. Example:
+//
+//	/v1/query?metric=awk_published_events_count&agg=sum&by=service&label[service]=int-activitypub&period=1h
+type Handler interface {
+	Query(ctx *gin.Context)
+}
+
+type handler struct {
+	svcMetrics service.Service
+	whitelist  []promql.Metric
+}
+
+const aggregationDefault = promql.AggregationSum
+const periodDefault = "1h"
+
+func NewHandler(svcMetrics service.Service, whitelist []promql.Metric) Handler {
+	return handler{
+		svcMetrics: svcMetrics,
+		whitelist:  whitelist,
+	}
+}
+
+func (h handler) Query(ctx *gin.Context) {
+	spec := promql.Spec{
+		Metric:      ctx.Query("metric"),
+		Aggregation: promql.Aggregation(ctx.DefaultQuery("agg", string(aggregationDefault))),
+		Filters:     ctx.QueryMap("label"),
+		Period:      ctx.DefaultQuery("period", periodDefault),
+	}
+	if by := ctx.Query("by"); by != "" {
+		for _, l := range strings.Split(by, ",") {
+			spec.By = append(spec.By, strings.TrimSpace(l))
+		}
+	}
+	q, err := promql.Build(spec, h.whitelist)
+	if err != nil {
+		apiHttp.RespondError(ctx, err)
+		return
+	}
+	vec, warns, err := h.svcMetrics.GetVector(ctx, q)
+	if err != nil {
+		apiHttp.RespondError(ctx, err)
+		return
+	}
+	if vec == nil {
+		vec = []service.Sample{}
+	}
+	apiHttp.SetWarnings(ctx, warns)
+	ctx.Header("Cache-Control", fmt.Sprintf("must-revalidate, public, max-age=%d", int(apiHttp.PeriodCacheMaxAge(spec.Period).Seconds())))
+	ctx.Header("Date", time.Now().Format(http.TimeFormat))
+	ctx.JSON(http.StatusOK, vec)
+}
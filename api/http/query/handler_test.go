@@ -0,0 +1,94 @@
+package query
+
+import (
+	"context"
+	"github.com/awakari/metrics/promql"
+	"github.com/awakari/metrics/service"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+type svcFake struct {
+	service.Service
+	queries *[]string
+}
+
+func (s svcFake) GetVector(ctx context.Context, query string) (vec []service.Sample, warns service.Warnings, err error) {
+	*s.queries = append(*s.queries, query)
+	return
+}
+
+func TestHandler_Query(t *testing.T) {
+	whitelist := []promql.Metric{
+		{
+			Name:    "awk_published_events_count",
+			Counter: true,
+			Labels:  []string{"service", "source"},
+		},
+	}
+	cases := map[string]struct {
+		query url.Values
+		code  int
+		promq string
+	}{
+		"ok": {
+			query: url.Values{
+				"metric":         {"awk_published_events_count"},
+				"by":             {"service"},
+				"label[service]": {"int-activitypub"},
+			},
+			code:  http.StatusOK,
+			promq: `sum by (service) (rate(awk_published_events_count{service="int-activitypub"}[1h]))`,
+		},
+		"label value is quoted": {
+			query: url.Values{
+				"metric":        {"awk_published_events_count"},
+				"label[source]": {"https://example.com/feed?a=1&b=2"},
+				"period":        {"1d"},
+			},
+			code:  http.StatusOK,
+			promq: `sum by () (rate(awk_published_events_count{source="https://example.com/feed?a=1&b=2"}[1d]))`,
+		},
+		"metric not whitelisted": {
+			query: url.Values{
+				"metric": {"up"},
+			},
+			code: http.StatusBadRequest,
+		},
+		"label value breaks the matcher": {
+			query: url.Values{
+				"metric":         {"awk_published_events_count"},
+				"label[service]": {`x"} or up{job="`},
+			},
+			code: http.StatusBadRequest,
+		},
+		"label name not whitelisted": {
+			query: url.Values{
+				"metric":          {"awk_published_events_count"},
+				"label[instance]": {"foo"},
+			},
+			code: http.StatusBadRequest,
+		},
+	}
+	gin.SetMode(gin.TestMode)
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			var queries []string
+			r := gin.New()
+			r.GET("/v1/query", NewHandler(svcFake{queries: &queries}, whitelist).Query)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/query?"+c.query.Encode(), nil))
+			assert.Equal(t, c.code, w.Code)
+			if c.promq == "" {
+				assert.Empty(t, queries)
+			} else {
+				assert.Equal(t, []string{c.promq}, queries)
+				assert.JSONEq(t, `[]`, w.Body.String())
+			}
+		})
+	}
+}
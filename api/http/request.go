@@ -0,0 +1,56 @@
+package http
+
+import (
+	"github.com/awakari/metrics/model"
+	"github.com/awakari/metrics/util"
+	"github.com/gin-gonic/gin"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// RequestLogger assigns the request id and logs the request when it's done.
+// The request id is taken from the "X-Request-Id" header when valid, otherwise it's generated.
+// It's returned in the same response header and flows through the request context into the logs and the outgoing calls.
+// The engine should have the ContextWithFallback enabled to make the id available via the gin context.
+type RequestLogger interface {
+	Handle(ctx *gin.Context)
+}
+
+type requestLogger struct {
+	log *slog.Logger
+}
+
+func NewRequestLogger(log *slog.Logger) RequestLogger {
+	return requestLogger{
+		log: log,
+	}
+}
+
+func (rl requestLogger) Handle(ctx *gin.Context) {
+	start := time.Now()
+	id := ctx.GetHeader(model.KeyRequestId)
+	if !util.ValidRequestId(id) {
+		id = util.NewRequestId()
+	}
+	ctx.Request = ctx.Request.WithContext(util.WithRequestId(ctx.Request.Context(), id))
+	ctx.Header(model.KeyRequestId, id)
+	ctx.Next()
+	code := ctx.Writer.Status()
+	lvl := slog.LevelDebug
+	switch {
+	case code >= http.StatusInternalServerError:
+		lvl = slog.LevelError
+	case code >= http.StatusBadRequest:
+		lvl = slog.LevelWarn
+	}
+	rl.log.Log(
+		ctx.Request.Context(), lvl, "http request",
+		"method", ctx.Request.Method,
+		"route", ctx.FullPath(),
+		"path", ctx.Request.URL.Path,
+		"status", code,
+		"duration", time.Since(start),
+		"errors", ctx.Errors.ByType(gin.ErrorTypeAny).String(),
+	)
+}
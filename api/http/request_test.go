@@ -0,0 +1,48 @@
+package http
+
+import (
+	"github.com/awakari/metrics/model"
+	"github.com/awakari/metrics/util"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestLogger_Handle(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.ContextWithFallback = true
+	r.Use(NewRequestLogger(slog.New(slog.NewTextHandler(io.Discard, nil))).Handle)
+	r.GET("/", func(ctx *gin.Context) {
+		ctx.String(http.StatusOK, util.RequestId(ctx))
+	})
+	cases := map[string]struct {
+		id    string
+		reuse bool
+	}{
+		"generated": {},
+		"reused": {
+			id:    "req-0",
+			reuse: true,
+		},
+		"invalid": {
+			id: "req 0",
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set(model.KeyRequestId, c.id)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			id := w.Header().Get(model.KeyRequestId)
+			assert.Equal(t, id, w.Body.String())
+			assert.True(t, util.ValidRequestId(id))
+			assert.Equal(t, c.reuse, id == c.id)
+		})
+	}
+}
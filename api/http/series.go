@@ -0,0 +1,85 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/common/model"
+	"strconv"
+	"time"
+)
+
+type SeriesRange struct {
+	Start time.Time
+	End   time.Time
+	Step  time.Duration
+}
+
+const seriesRangeDefault = 24 * time.Hour
+const seriesStepDefault = 15 * time.Minute
+const seriesPointsMax = 11_000
+const seriesCacheMaxAge = 1 * time.Hour
+
+var ErrInvalidSeriesRange = errors.New("invalid series range")
+
+// ParseSeriesRange reads the optional "start", "end" and "step" query parameters.
+// The start and end may be either RFC3339 timestamps or unix seconds, the step is a Prometheus duration (e.g. "5m", "1d").
+// By default, the range covers the last day till now with the 15 minutes step.
+func ParseSeriesRange(ctx *gin.Context) (sr SeriesRange, err error) {
+	sr.Step = seriesStepDefault
+	if v := ctx.Query("step"); v != "" {
+		var step model.Duration
+		step, err = model.ParseDuration(v)
+		sr.Step = time.Duration(step)
+	}
+	if err == nil && sr.Step > 0 {
+		// align to the step, so the same default range is queried during the step
+		sr.End = time.Now().UTC().Truncate(sr.Step)
+		if v := ctx.Query("end"); v != "" {
+			sr.End, err = parseTime(v)
+		}
+	}
+	if err == nil {
+		sr.Start = sr.End.Add(-seriesRangeDefault)
+		if v := ctx.Query("start"); v != "" {
+			sr.Start, err = parseTime(v)
+		}
+	}
+	switch {
+	case err != nil:
+		err = fmt.Errorf("%w: %s", ErrInvalidSeriesRange, err)
+	case sr.Step <= 0:
+		err = fmt.Errorf("%w: non-positive step %s", ErrInvalidSeriesRange, sr.Step)
+	case !sr.Start.Before(sr.End):
+		err = fmt.Errorf("%w: start %s is not before end %s", ErrInvalidSeriesRange, sr.Start, sr.End)
+	case sr.End.Sub(sr.Start)/sr.Step > seriesPointsMax:
+		err = fmt.Errorf("%w: too many points, increase the step or reduce the range", ErrInvalidSeriesRange)
+	}
+	return
+}
+
+// Period returns the step in the Prometheus duration format, to be used as a rate window.
+func (sr SeriesRange) Period() string {
+	return model.Duration(sr.Step).String()
+}
+
+// CacheMaxAge returns the time the response may be cached for: one step, but no longer than an hour.
+func (sr SeriesRange) CacheMaxAge() (d time.Duration) {
+	d = sr.Step
+	if d > seriesCacheMaxAge {
+		d = seriesCacheMaxAge
+	}
+	return
+}
+
+func parseTime(v string) (t time.Time, err error) {
+	var sec int64
+	sec, err = strconv.ParseInt(v, 10, 64)
+	switch err {
+	case nil:
+		t = time.Unix(sec, 0).UTC()
+	default:
+		t, err = time.Parse(time.RFC3339, v)
+	}
+	return
+}
@@ -0,0 +1,137 @@
+package source
+
+import (
+	"errors"
+	"fmt"
+	apiGrpcLimits "github.com/awakari/metrics/api/grpc/limits"
+	apiGrpcSrc "github.com/awakari/metrics/api/grpc/source"
+	apiHttp "github.com/awakari/metrics/api/http"
+	"github.com/awakari/metrics/catalog"
+	"github.com/awakari/metrics/model"
+	"github.com/awakari/metrics/service"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"time"
+)
+
+// Handler serves the single source statistics. The source is the URL-encoded query parameter. Example:
+//
+//	/v1/src/stats?source=https%3A%2F%2Fexample.com%2Ffeed.xml&period=1d
+//
+// It's not the "/v1/src/:source/stats" path parameter, as the source URLs contain slashes:
+// the router matches the decoded path, so the encoded slashes split the source into several path segments,
+// unless the raw path matching is enabled for all the routes.
+type Handler interface {
+	GetStats(ctx *gin.Context)
+}
+
+type Stats struct {
+	Source string `json:"source"`
+	service.SourceStats
+	Owner  Owner  `json:"owner"`
+	Limits Limits `json:"limits"`
+}
+
+// Owner describes whose publishing limits apply to the source.
+// The user id is not disclosed, SharedLimit tells whether the source shares the limit of its owner's other sources.
+type Owner struct {
+	// Type is one of: feed, site, telegram, activitypub, or empty when the source is not registered
+	Type        string `json:"type,omitempty"`
+	GroupId     string `json:"groupId"`
+	SharedLimit bool   `json:"sharedLimit"`
+}
+
+type Limits struct {
+	Hourly *Limit `json:"hourly,omitempty"`
+	Daily  *Limit `json:"daily,omitempty"`
+}
+
+type Limit struct {
+	Count   int64      `json:"count"`
+	Expires *time.Time `json:"expires,omitempty"`
+}
+
+type handler struct {
+	svcMetrics     service.Service
+	svcLimits      apiGrpcLimits.Service
+	resolver       apiGrpcSrc.Resolver
+	groupIdDefault string
+	metrics        catalog.Metrics
+}
+
+const periodDefault = "1d"
+
+func NewHandler(
+	svcMetrics service.Service,
+	svcLimits apiGrpcLimits.Service,
+	resolver apiGrpcSrc.Resolver,
+	groupIdDefault string,
+	metrics catalog.Metrics,
+) Handler {
+	return handler{
+		svcMetrics:     svcMetrics,
+		svcLimits:      svcLimits,
+		resolver:       resolver,
+		groupIdDefault: groupIdDefault,
+		metrics:        metrics,
+	}
+}
+
+func (h handler) GetStats(ctx *gin.Context) {
+	s := Stats{
+		Source: ctx.Query("source"),
+	}
+	period := ctx.DefaultQuery("period", periodDefault)
+	var warns service.Warnings
+	var err error
+	s.SourceStats, warns, err = service.GetSourceStats(ctx, h.svcMetrics, h.metrics.PublishedEvents, h.metrics.ReadCount, h.metrics.SourcesReadCount, s.Source, period)
+	if err != nil {
+		apiHttp.RespondError(ctx, err)
+		return
+	}
+	// limits are set by the groupId and the source url, see the SetMostReadLimits
+	s.Owner.GroupId = h.groupIdDefault
+	src, err := h.resolver.Resolve(ctx, s.Source)
+	switch {
+	case err == nil:
+		s.Owner.Type = src.Type.String()
+		s.Owner.GroupId = src.GroupId
+		s.Owner.SharedLimit = src.UserId != "" && src.UserId != s.Source
+	case errors.Is(err, apiGrpcSrc.ErrNotFound):
+	default:
+		apiHttp.RespondError(ctx, fmt.Errorf("%w: %s", service.ErrUnavailable, err))
+		return
+	}
+	if !s.Owner.SharedLimit {
+		s.Limits.Hourly, err = h.getLimit(ctx, s.Owner.GroupId, s.Source, model.SubjectPublishHourly)
+		if err == nil {
+			s.Limits.Daily, err = h.getLimit(ctx, s.Owner.GroupId, s.Source, model.SubjectPublishDaily)
+		}
+		if err != nil {
+			apiHttp.RespondError(ctx, fmt.Errorf("%w: %s", service.ErrUnavailable, err))
+			return
+		}
+	}
+	apiHttp.SetWarnings(ctx, warns)
+	ctx.Header("Cache-Control", fmt.Sprintf("must-revalidate, public, max-age=%d", int(apiHttp.PeriodCacheMaxAge(period).Seconds())))
+	ctx.Header("Date", time.Now().Format(http.TimeFormat))
+	ctx.JSON(http.StatusOK, s)
+}
+
+// getLimit returns nil when the source has no own limit.
+func (h handler) getLimit(ctx *gin.Context, groupId, userId string, subj model.Subject) (l *Limit, err error) {
+	var raw model.Limit
+	raw, err = h.svcLimits.GetRaw(ctx, groupId, userId, subj)
+	switch {
+	case err == nil:
+		l = &Limit{
+			Count: raw.Count,
+		}
+		if !raw.Expires.IsZero() {
+			l.Expires = &raw.Expires
+		}
+	case errors.Is(err, apiGrpcLimits.ErrNotFound):
+		err = nil
+	}
+	return
+}
@@ -0,0 +1,144 @@
+package source
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	apiGrpcLimits "github.com/awakari/metrics/api/grpc/limits"
+	apiGrpcSrc "github.com/awakari/metrics/api/grpc/source"
+	"github.com/awakari/metrics/catalog"
+	"github.com/awakari/metrics/model"
+	"github.com/awakari/metrics/service"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+type metricsFake struct {
+	service.Service
+}
+
+func (m metricsFake) GetValue(ctx context.Context, query string) (val float64, warns service.Warnings, err error) {
+	val = 1
+	return
+}
+
+func (m metricsFake) GetRateAverage(ctx context.Context, metricName string, sumBy string, period string) (rate float64, warns service.Warnings, err error) {
+	rate = 4
+	return
+}
+
+type limitsFake struct {
+	limits map[string]model.Limit
+}
+
+func (l limitsFake) GetRaw(ctx context.Context, groupId, userId string, subj model.Subject) (lim model.Limit, err error) {
+	lim, ok := l.limits[groupId+"/"+userId+"/"+subj.String()]
+	if !ok {
+		err = apiGrpcLimits.ErrNotFound
+	}
+	return
+}
+
+func (l limitsFake) Set(ctx context.Context, groupId, userId string, subj model.Subject, count int64, expires time.Time) (err error) {
+	err = errors.New("not implemented")
+	return
+}
+
+type resolverFake map[string]apiGrpcSrc.Source
+
+func (r resolverFake) Resolve(ctx context.Context, srcUrl string) (src apiGrpcSrc.Source, err error) {
+	switch srcUrl {
+	case "https://fail.com/feed.xml":
+		err = errors.New("unavailable")
+	default:
+		var ok bool
+		src, ok = r[srcUrl]
+		if !ok {
+			err = apiGrpcSrc.ErrNotFound
+		}
+	}
+	return
+}
+
+func TestHandler_GetStats(t *testing.T) {
+	expires := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	h := NewHandler(
+		metricsFake{},
+		limitsFake{
+			limits: map[string]model.Limit{
+				"group1/https://example.com/feed.xml/" + model.SubjectPublishHourly.String(): {Count: 10},
+				"group1/https://example.com/feed.xml/" + model.SubjectPublishDaily.String():  {Count: 100, Expires: expires},
+			},
+		},
+		resolverFake{
+			"https://example.com/feed.xml": {Type: apiGrpcSrc.TypeFeed, GroupId: "group1", UserId: "https://example.com/feed.xml"},
+			"https://t.me/channel0":        {Type: apiGrpcSrc.TypeTelegram, GroupId: "group1", UserId: "user1"},
+		},
+		"group0",
+		catalog.Metrics{},
+	)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/v1/src/stats", h.GetStats)
+	cases := map[string]struct {
+		code  int
+		stats Stats
+	}{
+		"https://example.com/feed.xml": {
+			code: http.StatusOK,
+			stats: Stats{
+				Owner: Owner{
+					Type:    "feed",
+					GroupId: "group1",
+				},
+				Limits: Limits{
+					Hourly: &Limit{Count: 10},
+					Daily:  &Limit{Count: 100, Expires: &expires},
+				},
+			},
+		},
+		"https://t.me/channel0": {
+			code: http.StatusOK,
+			stats: Stats{
+				Owner: Owner{
+					Type:        "telegram",
+					GroupId:     "group1",
+					SharedLimit: true,
+				},
+			},
+		},
+		"https://example.com/missing.xml": {
+			code: http.StatusOK,
+			stats: Stats{
+				Owner: Owner{
+					GroupId: "group0",
+				},
+			},
+		},
+		"https://fail.com/feed.xml": {
+			code: http.StatusBadGateway,
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/src/stats?period=1d&source="+url.QueryEscape(k), nil))
+			assert.Equal(t, c.code, w.Code)
+			if c.code == http.StatusOK {
+				var s Stats
+				assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &s))
+				assert.Equal(t, k, s.Source)
+				assert.Equal(t, 2, s.Rank)
+				assert.Equal(t, 0.25, s.ReadShare)
+				assert.Equal(t, c.stats.Owner, s.Owner)
+				assert.Equal(t, c.stats.Limits, s.Limits)
+				assert.Equal(t, "must-revalidate, public, max-age=3600", w.Header().Get("Cache-Control"))
+			}
+		})
+	}
+}
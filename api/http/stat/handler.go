@@ -0,0 +1,107 @@
+package stat
+
+import (
+	"errors"
+	"fmt"
+	apiHttp "github.com/awakari/metrics/api/http"
+	"github.com/awakari/metrics/catalog"
+	"github.com/awakari/metrics/service"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"time"
+)
+
+// Handler serves the single catalog statistic.
+type Handler interface {
+	Handle(ctx *gin.Context)
+}
+
+type handler struct {
+	svcMetrics service.Service
+	stat       catalog.Stat
+}
+
+func NewHandler(svcMetrics service.Service, stat catalog.Stat) Handler {
+	return handler{
+		svcMetrics: svcMetrics,
+		stat:       stat,
+	}
+}
+
+func (h handler) Handle(ctx *gin.Context) {
+	switch h.stat.Kind {
+	case catalog.KindValue:
+		h.value(ctx)
+	case catalog.KindHistory:
+		h.history(ctx)
+	case catalog.KindSeries:
+		h.series(ctx)
+	default:
+		apiHttp.RespondError(ctx, fmt.Errorf("stat %s has unsupported kind %q", h.stat.Name, h.stat.Kind))
+	}
+}
+
+func (h handler) value(ctx *gin.Context) {
+	period := ctx.Param("period")
+	q, err := h.stat.RenderQuery(catalog.QueryParams{
+		Period: period,
+	})
+	if err != nil {
+		apiHttp.RespondError(ctx, err)
+		return
+	}
+	val, warns, err := h.svcMetrics.GetValue(ctx, q)
+	if errors.Is(err, service.ErrEmptyResult) {
+		// no data means nothing happened over the period, e.g. the zero rate
+		err = nil
+	}
+	if err != nil {
+		apiHttp.RespondError(ctx, err)
+		return
+	}
+	apiHttp.SetWarnings(ctx, warns)
+	ctx.Header("Cache-Control", fmt.Sprintf("must-revalidate, public, max-age=%d", int(apiHttp.PeriodCacheMaxAge(period).Seconds())))
+	ctx.Header("Date", time.Now().Format(http.TimeFormat))
+	ctx.JSON(http.StatusOK, map[string]float64{"value": val})
+}
+
+func (h handler) history(ctx *gin.Context) {
+	q, err := h.stat.RenderQuery(catalog.QueryParams{})
+	if err != nil {
+		apiHttp.RespondError(ctx, err)
+		return
+	}
+	nh, warns, err := h.svcMetrics.GetNumberHistory(ctx, q)
+	if err != nil {
+		apiHttp.RespondError(ctx, err)
+		return
+	}
+	apiHttp.SetWarnings(ctx, warns)
+	ctx.Header("Cache-Control", "max-age=300, public")
+	ctx.Header("Date", time.Now().Format(http.TimeFormat))
+	ctx.JSON(http.StatusOK, nh)
+}
+
+func (h handler) series(ctx *gin.Context) {
+	sr, err := apiHttp.ParseSeriesRange(ctx)
+	if err != nil {
+		apiHttp.RespondError(ctx, err)
+		return
+	}
+	q, err := h.stat.RenderQuery(catalog.QueryParams{
+		Period: sr.Period(),
+	})
+	if err != nil {
+		apiHttp.RespondError(ctx, err)
+		return
+	}
+	series, warns, err := h.svcMetrics.GetSeries(ctx, q, sr.Start, sr.End, sr.Step)
+	if err != nil {
+		apiHttp.RespondError(ctx, err)
+		return
+	}
+	apiHttp.SetWarnings(ctx, warns)
+	ctx.Header("Cache-Control", fmt.Sprintf("must-revalidate, public, max-age=%d", int(sr.CacheMaxAge().Seconds())))
+	ctx.Header("Date", time.Now().Format(http.TimeFormat))
+	ctx.JSON(http.StatusOK, series)
+}
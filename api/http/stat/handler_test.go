@@ -0,0 +1,185 @@
+package stat
+
+import (
+	"context"
+	"fmt"
+	apiHttp "github.com/awakari/metrics/api/http"
+	"github.com/awakari/metrics/catalog"
+	"github.com/awakari/metrics/config"
+	"github.com/awakari/metrics/service"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const catalogTest = `
+metrics:
+  publishedEvents: awk_published_events_count
+  attrsObserved: awk_published_attrs_observed_count
+  readCount: awk_reader_read_count
+  sourcesReadCount: awk_reader_sources_read_count
+  durationBucket: awk_duration_bucket
+  followers: awk_followers_active_distinct_count
+  sourcesFeeds: awk_source_feeds_count_pull
+  sourcesSocials: awk_source_activitypub_count_total
+  sourcesRealtime: awk_source_feeds_count_push
+stats:
+  - name: rate
+    group: /v1
+    path: /rate/:period
+    kind: value
+    query: "sum(rate(metric0[{{ .Period }}]))"
+  - name: history
+    group: /v1
+    path: /history
+    kind: history
+    query: metric1
+  - name: series
+    group: /v1
+    path: /series
+    kind: series
+    query: "sum(rate(metric0[{{ .Period }}]))"
+`
+
+type svcFake struct {
+	service.Service
+	queries *[]string
+	err     error
+}
+
+func (s svcFake) GetValue(ctx context.Context, query string) (val float64, warns service.Warnings, err error) {
+	*s.queries = append(*s.queries, query)
+	if s.err != nil {
+		return 0, nil, s.err
+	}
+	return 1.5, service.Warnings{"warn0"}, nil
+}
+
+func (s svcFake) GetNumberHistory(ctx context.Context, metricName string) (nh service.NumberHistory, warns service.Warnings, err error) {
+	*s.queries = append(*s.queries, metricName)
+	nh.Current = 3
+	return nh, nil, s.err
+}
+
+func (s svcFake) GetSeries(ctx context.Context, metricName string, start, end time.Time, step time.Duration) (series []service.Point, warns service.Warnings, err error) {
+	*s.queries = append(*s.queries, metricName)
+	series = []service.Point{
+		{Time: start.Unix(), Value: 1},
+	}
+	return series, nil, s.err
+}
+
+func newRouter(t *testing.T, svc service.Service) *gin.Engine {
+	cat, err := catalog.Parse([]byte(catalogTest))
+	require.Nil(t, err)
+	v := apiHttp.NewValidator(config.PeriodConfig{
+		Min: time.Minute,
+		Max: 30 * 24 * time.Hour,
+	})
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	for _, stat := range cat.Stats {
+		r.Group(stat.Group).GET(stat.Path, v.Period, NewHandler(svc, stat).Handle)
+	}
+	return r
+}
+
+func TestHandler_Handle(t *testing.T) {
+	cases := map[string]struct {
+		path  string
+		err   error
+		code  int
+		body  string
+		query string
+		warn  string
+	}{
+		"value": {
+			path:  "/v1/rate/60m",
+			code:  http.StatusOK,
+			body:  `{"value":1.5}`,
+			query: "sum(rate(metric0[1h]))",
+			warn:  `199 metrics "warn0"`,
+		},
+		"value empty is zero": {
+			path:  "/v1/rate/1h",
+			err:   fmt.Errorf("%w: query", service.ErrEmptyResult),
+			code:  http.StatusOK,
+			body:  `{"value":0}`,
+			query: "sum(rate(metric0[1h]))",
+		},
+		"value invalid period": {
+			path: "/v1/rate/1s",
+			code: http.StatusBadRequest,
+		},
+		"value period too long": {
+			path: "/v1/rate/1y",
+			code: http.StatusBadRequest,
+		},
+		"value bad query": {
+			path:  "/v1/rate/1h",
+			err:   fmt.Errorf("%w: parse error", service.ErrBadQuery),
+			code:  http.StatusBadRequest,
+			query: "sum(rate(metric0[1h]))",
+		},
+		"history": {
+			path:  "/v1/history",
+			code:  http.StatusOK,
+			body:  `{"current":3,"past":{"hour":0,"day":0,"month":0}}`,
+			query: "metric1",
+		},
+		"history empty": {
+			path:  "/v1/history",
+			err:   fmt.Errorf("%w: metric1", service.ErrEmptyResult),
+			code:  http.StatusNotFound,
+			query: "metric1",
+		},
+		"history unavailable": {
+			path:  "/v1/history",
+			err:   fmt.Errorf("%w: connection refused", service.ErrUnavailable),
+			code:  http.StatusBadGateway,
+			query: "metric1",
+		},
+		"series": {
+			path:  "/v1/series?start=1000&end=4600&step=30m",
+			code:  http.StatusOK,
+			body:  `[{"t":1000,"v":1}]`,
+			query: "sum(rate(metric0[30m]))",
+		},
+		"series invalid step": {
+			path: "/v1/series?step=0s",
+			code: http.StatusBadRequest,
+		},
+		"series invalid range": {
+			path: "/v1/series?start=4600&end=1000",
+			code: http.StatusBadRequest,
+		},
+		"series unavailable": {
+			path:  "/v1/series?start=1000&end=4600&step=30m",
+			err:   fmt.Errorf("%w: connection refused", service.ErrUnavailable),
+			code:  http.StatusBadGateway,
+			query: "sum(rate(metric0[30m]))",
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			var queries []string
+			r := newRouter(t, svcFake{queries: &queries, err: c.err})
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, c.path, nil))
+			assert.Equal(t, c.code, w.Code)
+			if c.body != "" {
+				assert.JSONEq(t, c.body, w.Body.String())
+			}
+			if c.query == "" {
+				assert.Empty(t, queries)
+			} else {
+				assert.Equal(t, []string{c.query}, queries)
+			}
+			assert.Equal(t, c.warn, w.Header().Get(apiHttp.HeaderWarning))
+		})
+	}
+}
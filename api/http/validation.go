@@ -0,0 +1,94 @@
+package http
+
+import (
+	"fmt"
+	"github.com/awakari/metrics/config"
+	"github.com/awakari/metrics/promql"
+	"github.com/gin-gonic/gin"
+	"net/url"
+	"strings"
+)
+
+// Validator rejects the requests with the malformed parameters before these reach the metrics service.
+type Validator interface {
+
+	// Period checks the "period" path or query parameter, if present, and replaces it with the canonical form.
+	Period(ctx *gin.Context)
+
+	// AttrName checks the "name" path parameter to be a valid label name.
+	AttrName(ctx *gin.Context)
+
+	// Source checks the "source" query parameter to be either the http(s) URL or the "site:" prefixed domain.
+	Source(ctx *gin.Context)
+}
+
+type validator struct {
+	cfg config.PeriodConfig
+}
+
+const paramPeriod = "period"
+const paramName = "name"
+const paramSource = "source"
+
+// sourceLenMax is the maximum source length accepted, the longer ones are not the real sources.
+const sourceLenMax = 2048
+
+const prefixSite = "site:"
+
+func NewValidator(cfg config.PeriodConfig) Validator {
+	return validator{
+		cfg: cfg,
+	}
+}
+
+func (v validator) Period(ctx *gin.Context) {
+	for i, p := range ctx.Params {
+		if p.Key == paramPeriod {
+			period, err := promql.ParsePeriod(p.Value, v.cfg.Min, v.cfg.Max)
+			if err != nil {
+				RespondError(ctx, err)
+				return
+			}
+			ctx.Params[i].Value = period
+		}
+	}
+	// don't use ctx.Query() here, it would cache the query values before these are replaced
+	q := ctx.Request.URL.Query()
+	if q.Has(paramPeriod) {
+		period, err := promql.ParsePeriod(q.Get(paramPeriod), v.cfg.Min, v.cfg.Max)
+		if err != nil {
+			RespondError(ctx, err)
+			return
+		}
+		q.Set(paramPeriod, period)
+		ctx.Request.URL.RawQuery = q.Encode()
+	}
+}
+
+func (v validator) AttrName(ctx *gin.Context) {
+	name := ctx.Param(paramName)
+	if !promql.ValidName(name) {
+		RespondError(ctx, fmt.Errorf("%w: attribute name %q", promql.ErrInvalid, name))
+	}
+}
+
+func (v validator) Source(ctx *gin.Context) {
+	src := ctx.Query(paramSource)
+	if !validSource(src) {
+		RespondError(ctx, fmt.Errorf("%w: source %q", promql.ErrInvalid, src))
+	}
+}
+
+func validSource(src string) (ok bool) {
+	if src == "" || len(src) > sourceLenMax {
+		return
+	}
+	if domain, site := strings.CutPrefix(src, prefixSite); site {
+		u, err := url.Parse("https://" + domain)
+		ok = err == nil && u.Host != "" && u.Host == domain
+		return
+	}
+	u, err := url.Parse(src)
+	ok = err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" && u.User == nil
+	return
+}
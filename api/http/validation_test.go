@@ -0,0 +1,67 @@
+package http
+
+import (
+	"github.com/awakari/metrics/config"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidator(t *testing.T) {
+	v := NewValidator(config.PeriodConfig{
+		Min: time.Minute,
+		Max: 30 * 24 * time.Hour,
+	})
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/read/:period", v.Period, func(ctx *gin.Context) {
+		ctx.String(http.StatusOK, ctx.Param("period"))
+	})
+	r.GET("/query", v.Period, func(ctx *gin.Context) {
+		ctx.String(http.StatusOK, ctx.Query("period"))
+	})
+	r.GET("/values/:name", v.AttrName, func(ctx *gin.Context) {
+		ctx.String(http.StatusOK, ctx.Param("name"))
+	})
+	r.GET("/src", v.Source, func(ctx *gin.Context) {
+		ctx.String(http.StatusOK, ctx.Query("source"))
+	})
+	cases := map[string]struct {
+		code int
+		body string
+	}{
+		"/read/60m":                            {code: http.StatusOK, body: "1h"},
+		"/read/1w":                             {code: http.StatusOK, body: "1w"},
+		"/read/1s":                             {code: http.StatusBadRequest},
+		"/read/1y":                             {code: http.StatusBadRequest},
+		"/read/1h%5D))%20or%20vector(1)%20%23": {code: http.StatusBadRequest},
+		"/query?metric=m0&period=1d":           {code: http.StatusOK, body: "1d"},
+		"/query?metric=m0":                     {code: http.StatusOK, body: ""},
+		"/query?metric=m0&period=1h%5D)":       {code: http.StatusBadRequest},
+		"/values/source":                       {code: http.StatusOK, body: "source"},
+		"/values/source)%20(up":                {code: http.StatusBadRequest},
+		"/values/source,%20__name__":           {code: http.StatusBadRequest},
+		"/src?source=https%3A%2F%2Fexample.com%2Ffeed.xml":                     {code: http.StatusOK, body: "https://example.com/feed.xml"},
+		"/src?source=site%3Aexample.com":                                       {code: http.StatusOK, body: "site:example.com"},
+		"/src":                                                                 {code: http.StatusBadRequest},
+		"/src?source=example.com":                                              {code: http.StatusBadRequest},
+		"/src?source=ftp%3A%2F%2Fexample.com":                                  {code: http.StatusBadRequest},
+		"/src?source=https%3A%2F%2Fuser%40example.com":                         {code: http.StatusBadRequest},
+		"/src?source=site%3Aexample.com%2Fpath":                                {code: http.StatusBadRequest},
+		"/src?source=https%3A%2F%2Fexample.com%2F" + strings.Repeat("a", 2048): {code: http.StatusBadRequest},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, k, nil))
+			assert.Equal(t, c.code, w.Code)
+			if c.code == http.StatusOK {
+				assert.Equal(t, c.body, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package catalog
+
+import (
+	"bytes"
+	_ "embed"
+	"errors"
+	"fmt"
+	"github.com/awakari/metrics/promql"
+	"gopkg.in/yaml.v3"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// Catalog maps the logical statistics to the Prometheus metrics and queries.
+type Catalog struct {
+	Metrics Metrics `yaml:"metrics"`
+	Stats   []Stat  `yaml:"stats"`
+	Query   Query   `yaml:"query"`
+}
+
+// Metrics contains the metric names used by the statistics that can not be expressed by a single query.
+type Metrics struct {
+	PublishedEvents  string `yaml:"publishedEvents"`
+	AttrsObserved    string `yaml:"attrsObserved"`
+	ReadCount        string `yaml:"readCount"`
+	SourcesReadCount string `yaml:"sourcesReadCount"`
+	DurationBucket   string `yaml:"durationBucket"`
+	Followers        string `yaml:"followers"`
+	SourcesFeeds     string `yaml:"sourcesFeeds"`
+	SourcesSocials   string `yaml:"sourcesSocials"`
+	SourcesRealtime  string `yaml:"sourcesRealtime"`
+}
+
+// Query contains the whitelist of the metrics available via the generic query endpoint.
+type Query struct {
+	Metrics []promql.Metric `yaml:"metrics"`
+}
+
+type Kind string
+
+const (
+	KindValue   Kind = "value"
+	KindHistory Kind = "history"
+	KindSeries  Kind = "series"
+)
+
+// Stat is the public statistic served by the HTTP route generated for it.
+type Stat struct {
+	Name  string `yaml:"name"`
+	Group string `yaml:"group"`
+	Path  string `yaml:"path"`
+	Kind  Kind   `yaml:"kind"`
+	Query string `yaml:"query"`
+	tmpl  *template.Template
+}
+
+// QueryParams are the values available in the Stat query template.
+type QueryParams struct {
+	Period string
+}
+
+//go:embed default.yaml
+var catalogDefault []byte
+
+var ErrInvalid = errors.New("invalid catalog")
+
+// Load reads the catalog from the YAML (or JSON) file. The built-in catalog is used when the path is empty.
+func Load(path string) (c Catalog, err error) {
+	data := catalogDefault
+	if path != "" {
+		data, err = os.ReadFile(path)
+	}
+	if err == nil {
+		c, err = Parse(data)
+	}
+	return
+}
+
+func Parse(data []byte) (c Catalog, err error) {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	err = dec.Decode(&c)
+	if err != nil {
+		err = fmt.Errorf("%w: %s", ErrInvalid, err)
+	}
+	if err == nil {
+		err = c.Metrics.validate()
+	}
+	names := make(map[string]bool)
+	for i := 0; err == nil && i < len(c.Stats); i++ {
+		s := &c.Stats[i]
+		switch {
+		case s.Name == "":
+			err = fmt.Errorf("%w: stat #%d has no name", ErrInvalid, i)
+		case names[s.Name]:
+			err = fmt.Errorf("%w: duplicate stat name %s", ErrInvalid, s.Name)
+		case !strings.HasPrefix(s.Group, "/") || !strings.HasPrefix(s.Path, "/"):
+			err = fmt.Errorf("%w: stat %s group and path should start with /", ErrInvalid, s.Name)
+		case s.Kind != KindValue && s.Kind != KindHistory && s.Kind != KindSeries:
+			err = fmt.Errorf("%w: stat %s has unknown kind %q", ErrInvalid, s.Name, s.Kind)
+		case s.Query == "":
+			err = fmt.Errorf("%w: stat %s has no query", ErrInvalid, s.Name)
+		default:
+			names[s.Name] = true
+			s.tmpl, err = template.New(s.Name).Option("missingkey=error").Parse(s.Query)
+			if err != nil {
+				err = fmt.Errorf("%w: stat %s query template: %s", ErrInvalid, s.Name, err)
+			}
+		}
+	}
+	for i := 0; err == nil && i < len(c.Query.Metrics); i++ {
+		err = promql.ValidateMetric(c.Query.Metrics[i])
+		if err != nil {
+			err = fmt.Errorf("%w: %s", ErrInvalid, err)
+		}
+	}
+	return
+}
+
+// RenderQuery returns the PromQL query for the given parameters.
+func (s Stat) RenderQuery(params QueryParams) (q string, err error) {
+	buf := &bytes.Buffer{}
+	err = s.tmpl.Execute(buf, params)
+	q = buf.String()
+	return
+}
+
+func (m Metrics) validate() (err error) {
+	for k, v := range map[string]string{
+		"publishedEvents":  m.PublishedEvents,
+		"attrsObserved":    m.AttrsObserved,
+		"readCount":        m.ReadCount,
+		"sourcesReadCount": m.SourcesReadCount,
+		"durationBucket":   m.DurationBucket,
+		"followers":        m.Followers,
+		"sourcesFeeds":     m.SourcesFeeds,
+		"sourcesSocials":   m.SourcesSocials,
+		"sourcesRealtime":  m.SourcesRealtime,
+	} {
+		if v == "" {
+			err = errors.Join(err, fmt.Errorf("%w: metric %s is not set", ErrInvalid, k))
+		}
+	}
+	return
+}
@@ -0,0 +1,115 @@
+package catalog
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestLoad_Default(t *testing.T) {
+	c, err := Load("")
+	assert.Nil(t, err)
+	assert.Equal(t, "awk_reader_read_count", c.Metrics.ReadCount)
+	assert.NotEmpty(t, c.Stats)
+	for _, s := range c.Stats {
+		q, err := s.RenderQuery(QueryParams{Period: "1h"})
+		assert.Nil(t, err)
+		assert.NotEmpty(t, q)
+	}
+}
+
+func TestParse(t *testing.T) {
+	metrics := `
+metrics:
+  publishedEvents: m0
+  attrsObserved: m1
+  readCount: m2
+  sourcesReadCount: m3
+  durationBucket: m4
+  followers: m5
+  sourcesFeeds: m6
+  sourcesSocials: m7
+  sourcesRealtime: m8
+`
+	cases := map[string]struct {
+		in    string
+		query string
+		err   error
+	}{
+		"ok": {
+			in: metrics + `
+stats:
+  - name: stat0
+    group: /v1/public
+    path: /stat0/:period
+    kind: value
+    query: "sum(rate(fork_events_count[{{ .Period }}]))"
+`,
+			query: "sum(rate(fork_events_count[1h]))",
+		},
+		"json": {
+			in:    `{"metrics": {"publishedEvents": "m0", "attrsObserved": "m1", "readCount": "m2", "sourcesReadCount": "m3", "durationBucket": "m4", "followers": "m5", "sourcesFeeds": "m6", "sourcesSocials": "m7", "sourcesRealtime": "m8"}, "stats": [{"name": "stat0", "group": "/v1", "path": "/stat0", "kind": "history", "query": "m5"}]}`,
+			query: "m5",
+		},
+		"missing metric": {
+			in: `
+metrics:
+  publishedEvents: m0
+`,
+			err: ErrInvalid,
+		},
+		"unknown field": {
+			in:  metrics + "foo: bar\n",
+			err: ErrInvalid,
+		},
+		"unknown kind": {
+			in: metrics + `
+stats:
+  - name: stat0
+    group: /v1
+    path: /stat0
+    kind: foo
+    query: m5
+`,
+			err: ErrInvalid,
+		},
+		"duplicate name": {
+			in: metrics + `
+stats:
+  - name: stat0
+    group: /v1
+    path: /stat0
+    kind: history
+    query: m5
+  - name: stat0
+    group: /v1
+    path: /stat1
+    kind: history
+    query: m6
+`,
+			err: ErrInvalid,
+		},
+		"bad template": {
+			in: metrics + `
+stats:
+  - name: stat0
+    group: /v1
+    path: /stat0
+    kind: history
+    query: "{{ .Period"
+`,
+			err: ErrInvalid,
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			cat, err := Parse([]byte(c.in))
+			assert.ErrorIs(t, err, c.err)
+			if err == nil {
+				var q string
+				q, err = cat.Stats[0].RenderQuery(QueryParams{Period: "1h"})
+				assert.Nil(t, err)
+				assert.Equal(t, c.query, q)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package condition
+
+import (
+	"fmt"
+	"github.com/awakari/metrics/api/grpc/interests"
+	"strconv"
+	"strings"
+)
+
+// Node is the structured form of the interest condition.
+// The group node has the Logic and Group set, the text one has the Term, the number one has the Op and Val.
+type Node struct {
+	Type  Type   `json:"type"`
+	Not   bool   `json:"not,omitempty"`
+	Logic string `json:"logic,omitempty"`
+	Group []Node `json:"group,omitempty"`
+	// Key is the event attribute name, any attribute when empty.
+	Key   string   `json:"key,omitempty"`
+	Term  string   `json:"term,omitempty"`
+	Exact bool     `json:"exact,omitempty"`
+	Op    string   `json:"op,omitempty"`
+	Val   *float64 `json:"val,omitempty"`
+}
+
+type Type string
+
+const (
+	TypeGroup  Type = "group"
+	TypeText   Type = "text"
+	TypeNumber Type = "number"
+)
+
+var logics = map[interests.GroupLogic]string{
+	interests.GroupLogic_And: "and",
+	interests.GroupLogic_Or:  "or",
+	interests.GroupLogic_Xor: "xor",
+}
+
+var ops = map[interests.Operation]string{
+	interests.Operation_Gt:  ">",
+	interests.Operation_Gte: ">=",
+	interests.Operation_Eq:  "=",
+	interests.Operation_Lte: "<=",
+	interests.Operation_Lt:  "<",
+}
+
+// keyAny is rendered in place of the empty key of the exact text and the number conditions.
+const keyAny = "*"
+
+// Tree returns the structured form of the condition, nil when the condition is not set.
+func Tree(cond *interests.Condition) (n *Node) {
+	switch c := cond.GetCond().(type) {
+	case *interests.Condition_Gc:
+		n = &Node{
+			Type:  TypeGroup,
+			Logic: logics[c.Gc.GetLogic()],
+			Group: []Node{},
+		}
+		for _, child := range c.Gc.GetGroup() {
+			if childNode := Tree(child); childNode != nil {
+				n.Group = append(n.Group, *childNode)
+			}
+		}
+	case *interests.Condition_Tc:
+		n = &Node{
+			Type:  TypeText,
+			Key:   c.Tc.GetKey(),
+			Term:  c.Tc.GetTerm(),
+			Exact: c.Tc.GetExact(),
+		}
+	case *interests.Condition_Nc:
+		val := c.Nc.GetVal()
+		n = &Node{
+			Type: TypeNumber,
+			Key:  c.Nc.GetKey(),
+			Op:   ops[c.Nc.GetOp()],
+			Val:  &val,
+		}
+	default:
+		return
+	}
+	n.Not = cond.GetNot()
+	return
+}
+
+// Render returns the condition as the readable expression, e.g.:
+//
+//	title: "bitcoin" and not (lang = "de" or price > 1000)
+//
+// The text condition without the key matches any attribute, ":" means the attribute contains the terms,
+// "=" means the exact match. The exact text and the number conditions without the key have the "*" key. Empty string is returned when the condition is not set.
+func Render(cond *interests.Condition) string {
+	n := Tree(cond)
+	if n == nil {
+		return ""
+	}
+	sb := &strings.Builder{}
+	render(sb, *n, true)
+	return sb.String()
+}
+
+func render(sb *strings.Builder, n Node, top bool) {
+	if n.Not {
+		sb.WriteString("not ")
+	}
+	switch n.Type {
+	case TypeGroup:
+		switch len(n.Group) {
+		case 0:
+			sb.WriteString("()")
+		case 1:
+			render(sb, n.Group[0], top && !n.Not)
+		default:
+			parens := !top || n.Not
+			if parens {
+				sb.WriteString("(")
+			}
+			for i, child := range n.Group {
+				if i > 0 {
+					fmt.Fprintf(sb, " %s ", n.Logic)
+				}
+				render(sb, child, false)
+			}
+			if parens {
+				sb.WriteString(")")
+			}
+		}
+	case TypeText:
+		term := strconv.Quote(n.Term)
+		switch {
+		case n.Exact:
+			fmt.Fprintf(sb, "%s = %s", keyOrAny(n.Key), term)
+		case n.Key != "":
+			fmt.Fprintf(sb, "%s: %s", n.Key, term)
+		default:
+			sb.WriteString(term)
+		}
+	case TypeNumber:
+		fmt.Fprintf(sb, "%s %s %s", keyOrAny(n.Key), n.Op, strconv.FormatFloat(*n.Val, 'f', -1, 64))
+	}
+}
+
+func keyOrAny(key string) string {
+	if key == "" {
+		key = keyAny
+	}
+	return key
+}
@@ -0,0 +1,119 @@
+package condition
+
+import (
+	"encoding/json"
+	"github.com/awakari/metrics/api/grpc/interests"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func textCond(key, term string, exact, not bool) *interests.Condition {
+	return &interests.Condition{
+		Not: not,
+		Cond: &interests.Condition_Tc{
+			Tc: &interests.TextCondition{
+				Key:   key,
+				Term:  term,
+				Exact: exact,
+			},
+		},
+	}
+}
+
+func numCond(key string, op interests.Operation, val float64) *interests.Condition {
+	return &interests.Condition{
+		Cond: &interests.Condition_Nc{
+			Nc: &interests.NumberCondition{
+				Key: key,
+				Op:  op,
+				Val: val,
+			},
+		},
+	}
+}
+
+func groupCond(logic interests.GroupLogic, not bool, group ...*interests.Condition) *interests.Condition {
+	return &interests.Condition{
+		Not: not,
+		Cond: &interests.Condition_Gc{
+			Gc: &interests.GroupCondition{
+				Logic: logic,
+				Group: group,
+			},
+		},
+	}
+}
+
+func TestRender(t *testing.T) {
+	cases := map[string]struct {
+		cond *interests.Condition
+		expr string
+	}{
+		"nil": {},
+		"text": {
+			cond: textCond("", "bitcoin", false, false),
+			expr: `"bitcoin"`,
+		},
+		"text exact any key": {
+			cond: textCond("", "bitcoin", true, true),
+			expr: `not * = "bitcoin"`,
+		},
+		"number": {
+			cond: numCond("price", interests.Operation_Gte, 1000.5),
+			expr: `price >= 1000.5`,
+		},
+		"number any key": {
+			cond: numCond("", interests.Operation_Gt, 5),
+			expr: `* > 5`,
+		},
+		"nested groups": {
+			cond: groupCond(
+				interests.GroupLogic_And,
+				false,
+				textCond("title", "bitcoin", false, false),
+				groupCond(
+					interests.GroupLogic_Or,
+					true,
+					textCond("lang", "de", true, false),
+					numCond("price", interests.Operation_Gt, 1000),
+				),
+				groupCond(
+					interests.GroupLogic_Xor,
+					false,
+					textCond("", "a", false, false),
+					textCond("", "b", false, false),
+				),
+			),
+			expr: `title: "bitcoin" and not (lang = "de" or price > 1000) and ("a" xor "b")`,
+		},
+		"negated top group": {
+			cond: groupCond(interests.GroupLogic_Or, true, textCond("", "a", false, false), textCond("", "b", false, false)),
+			expr: `not ("a" or "b")`,
+		},
+		"single child group": {
+			cond: groupCond(interests.GroupLogic_And, false, textCond("", "a", false, false)),
+			expr: `"a"`,
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			assert.Equal(t, c.expr, Render(c.cond))
+		})
+	}
+}
+
+func TestTree(t *testing.T) {
+	n := Tree(groupCond(interests.GroupLogic_Or, true, textCond("title", "a", true, false), numCond("price", interests.Operation_Lt, 1)))
+	data, err := json.Marshal(n)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{
+		"type": "group",
+		"not": true,
+		"logic": "or",
+		"group": [
+			{"type": "text", "key": "title", "term": "a", "exact": true},
+			{"type": "number", "key": "price", "op": "<", "val": 1}
+		]
+	}`, string(data))
+	assert.Nil(t, Tree(nil))
+}
@@ -1,10 +1,13 @@
 package config
 
 import (
+	"errors"
 	"github.com/kelseyhightower/envconfig"
 	"time"
 )
 
+var ErrNoDefaultGroup = errors.New("LIMITS_DEFAULT_GROUPS should contain at least one group id")
+
 type Config struct {
 	Admin struct {
 	}
@@ -15,6 +18,12 @@ type Config struct {
 			Feeds       FeedsConfig
 			Sites       SitesConfig
 			Telegram    TelegramConfig
+			Cache       struct {
+				// Capacity is the max count of the resolved sources to remember
+				Capacity uint32 `envconfig:"API_SOURCE_CACHE_CAPACITY" default:"10000" required:"true"`
+				// Ttl is the duration to remember the resolved source owner
+				Ttl time.Duration `envconfig:"API_SOURCE_CACHE_TTL" default:"1h" required:"true"`
+			}
 		}
 		Interests InterestsConfig
 		Http      struct {
@@ -24,13 +33,100 @@ type Config struct {
 		Metrics struct {
 			Port uint16 `envconfig:"API_METRICS_PORT" default:"9090" required:"true"`
 		}
+		// Period defines the bounds of the period requested by the API clients
+		Period     PeriodConfig
 		Prometheus PrometheusConfig
 		Usage      UsageConfig
 	}
+	Anomaly AnomalyConfig
+	Catalog struct {
+		// Path is the metric catalog file location, the built-in catalog is used when not set.
+		Path string `envconfig:"CATALOG_PATH" default:""`
+	}
+	Health HealthConfig
 	Limits LimitsConfig
 	Log    struct {
 		Level int `envconfig:"LOG_LEVEL" default:"-4" required:"true"`
+		// Format is either "text" or "json"
+		Format string `envconfig:"LOG_FORMAT" default:"text" required:"true"`
+	}
+	Scheduler SchedulerConfig
+	Shutdown  ShutdownConfig
+	Tracing   TracingConfig
+	Trending  TrendingConfig
+}
+
+// AnomalyConfig defines the publish and read rates anomaly detection.
+type AnomalyConfig struct {
+	Interval time.Duration `envconfig:"ANOMALY_INTERVAL" default:"5m" required:"true"`
+	// Window is the rate computation range
+	Window time.Duration `envconfig:"ANOMALY_WINDOW" default:"1h" required:"true"`
+	// Weeks is the number of the previous weeks to compare with at the same time of the week
+	Weeks uint32 `envconfig:"ANOMALY_WEEKS" default:"4" required:"true"`
+	// Threshold is the minimum deviation from the baseline, in the baseline standard deviations
+	Threshold float64 `envconfig:"ANOMALY_THRESHOLD" default:"3" required:"true"`
+	// MinChange is the minimum relative deviation from the baseline, e.g. 0.5 means 50%
+	MinChange float64 `envconfig:"ANOMALY_MIN_CHANGE" default:"0.5" required:"true"`
+}
+
+type SchedulerConfig struct {
+	Lock struct {
+		// Type is one of:
+		// * "file", the lock file per job in the directory shared by the replicas, the default outside the cluster
+		// * "lease", the Kubernetes lease per job, falls back to "file" when not running in the cluster
+		// * "none", for the single replica only
+		Type string `envconfig:"SCHEDULER_LOCK_TYPE" default:"file" required:"true"`
+		File struct {
+			// Dir contains the lock files, the temporary directory when empty
+			Dir string `envconfig:"SCHEDULER_LOCK_FILE_DIR" default:""`
+		}
+		Lease struct {
+			// Namespace of the leases, the pod's one when empty
+			Namespace string `envconfig:"SCHEDULER_LOCK_LEASE_NAMESPACE" default:""`
+		}
 	}
+	// ReplicasMax is the maximum count of the replicas, the jobs are not started without the lock when it's more than 1
+	ReplicasMax uint32 `envconfig:"SCHEDULER_REPLICAS_MAX" default:"1" required:"true"`
+	Limits struct {
+		// Schedule is the cron expression to set the most read sources limits, disabled when empty
+		Schedule string        `envconfig:"SCHEDULER_LIMITS_SCHEDULE" default:""`
+		Timeout  time.Duration `envconfig:"SCHEDULER_LIMITS_TIMEOUT" default:"10m" required:"true"`
+	}
+}
+
+// ShutdownConfig defines the graceful shutdown on SIGTERM or SIGINT.
+type ShutdownConfig struct {
+	// Delay is the time to keep serving after reporting NOT_SERVING, until the clients notice it
+	Delay time.Duration `envconfig:"SHUTDOWN_DELAY" default:"0s"`
+	// Timeout bounds the whole shutdown, including the delay, the pending requests are cancelled after
+	Timeout time.Duration `envconfig:"SHUTDOWN_TIMEOUT" default:"20s" required:"true"`
+}
+
+type TracingConfig struct {
+	// Exporter is one of: none, otlp, stdout, file
+	Exporter string `envconfig:"TRACING_EXPORTER" default:"none" required:"true"`
+	// Endpoint is the OTLP gRPC collector address, the OTEL_EXPORTER_OTLP_* variables are used when empty
+	Endpoint    string  `envconfig:"TRACING_OTLP_ENDPOINT" default:""`
+	Insecure    bool    `envconfig:"TRACING_OTLP_INSECURE" default:"true"`
+	Path        string  `envconfig:"TRACING_FILE_PATH" default:"traces.json"`
+	SampleRatio float64 `envconfig:"TRACING_SAMPLE_RATIO" default:"1" required:"true"`
+}
+
+// TrendingConfig defines the interests followers snapshots to rank the interests by the followers growth.
+type TrendingConfig struct {
+	Interval time.Duration `envconfig:"TRENDING_INTERVAL" default:"15m" required:"true"`
+	// Top is the count of the interests with the most followers to snapshot
+	Top uint32 `envconfig:"TRENDING_TOP" default:"1000" required:"true"`
+	// Path is the file to keep the snapshots across the restarts, these are kept in memory only when empty.
+	// The snapshots are local to the replica, the consistent ranking requires a single replica.
+	Path string `envconfig:"TRENDING_PATH" default:""`
+}
+
+// HealthConfig defines the periodic dependency checks the readiness is derived from.
+type HealthConfig struct {
+	Interval time.Duration `envconfig:"HEALTH_INTERVAL" default:"10s" required:"true"`
+	// Timeout limits every dependency check
+	Timeout time.Duration `envconfig:"HEALTH_TIMEOUT" default:"5s" required:"true"`
 }
 
 type LimitsConfig struct {
@@ -51,6 +147,37 @@ type LimitsConfig struct {
 			}
 		}
 	}
+	Policy LimitPolicyConfig
+	// Update defines how the most read sources limits are updated
+	Update struct {
+		// Parallelism is the number of sources processed concurrently
+		Parallelism uint32        `envconfig:"LIMITS_UPDATE_PARALLELISM" default:"16" required:"true"`
+		CallTimeout time.Duration `envconfig:"LIMITS_UPDATE_CALL_TIMEOUT" default:"10s" required:"true"`
+	}
+}
+
+// GroupIdDefault returns the first of the default groups, the one the metrics service acts on behalf of.
+func (lc LimitsConfig) GroupIdDefault() (groupId string, err error) {
+	switch {
+	case len(lc.Default.Groups) == 0, lc.Default.Groups[0] == "":
+		err = ErrNoDefaultGroup
+	default:
+		groupId = lc.Default.Groups[0]
+	}
+	return
+}
+
+// LimitPolicyConfig defines how the automatic limits of the most read sources are computed.
+type LimitPolicyConfig struct {
+	// Name is one of: linear, logarithmic, tiered, percentile
+	Name string `envconfig:"LIMITS_POLICY" default:"linear" required:"true"`
+	// ByType overrides the policy name by the source type, e.g. "telegram:logarithmic,feed:tiered"
+	ByType     map[string]string `envconfig:"LIMITS_POLICY_BY_TYPE" default:""`
+	Expiration time.Duration     `envconfig:"LIMITS_POLICY_EXPIRATION" default:"1h" required:"true"`
+	// LogScale is the logarithmic policy steepness, the greater value favors the less read sources more
+	LogScale float64 `envconfig:"LIMITS_POLICY_LOG_SCALE" default:"100" required:"true"`
+	// Tiers maps the minimum relative read rate to the share of the max limit for the tiered policy
+	Tiers map[float64]float64 `envconfig:"LIMITS_POLICY_TIERS" default:"0.001:0.01,0.01:0.1,0.1:0.5,0.5:1" required:"true"`
 }
 
 type FeedsConfig struct {
@@ -78,10 +205,24 @@ type InterestsConfig struct {
 		}
 		IdleTimeout time.Duration `envconfig:"API_INTERESTS_CONN_IDLE_TIMEOUT" default:"15m" required:"true"`
 	}
+	// Read defines how the found interests details are read concurrently
+	Read struct {
+		Parallelism uint32        `envconfig:"API_INTERESTS_READ_PARALLELISM" default:"10" required:"true"`
+		Timeout     time.Duration `envconfig:"API_INTERESTS_READ_TIMEOUT" default:"5s" required:"true"`
+	}
 }
 
 type PrometheusConfig struct {
 	Uri string `envconfig:"API_PROMETHEUS_URI" default:"http://prometheus-server:80" required:"true"`
+	// Timeout limits the query shared by the concurrent callers, these stop waiting for it on their own deadlines
+	Timeout time.Duration `envconfig:"API_PROMETHEUS_TIMEOUT" default:"1m" required:"true"`
+	Cache   struct {
+		Capacity uint32 `envconfig:"API_PROMETHEUS_CACHE_CAPACITY" default:"1000" required:"true"`
+		Ttl      struct {
+			Min time.Duration `envconfig:"API_PROMETHEUS_CACHE_TTL_MIN" default:"15s" required:"true"`
+			Max time.Duration `envconfig:"API_PROMETHEUS_CACHE_TTL_MAX" default:"5m" required:"true"`
+		}
+	}
 }
 
 type CookieConfig struct {
@@ -93,6 +234,12 @@ type CookieConfig struct {
 	Secret   string        `envconfig:"API_HTTP_COOKIE_SECRET" required:"true"`
 }
 
+// PeriodConfig is shared by the HTTP and gRPC APIs, the variable names are kept since it was HTTP only.
+type PeriodConfig struct {
+	Min time.Duration `envconfig:"API_HTTP_PERIOD_MIN" default:"1m" required:"true"`
+	Max time.Duration `envconfig:"API_HTTP_PERIOD_MAX" default:"720h" required:"true"`
+}
+
 type UsageConfig struct {
 	Uri        string `envconfig:"API_USAGE_URI" default:"usage:50051" required:"true"`
 	Connection struct {
@@ -17,4 +17,15 @@ func TestConfig(t *testing.T) {
     assert.Equal(t, uint16(56789), cfg.Api.Port)
     assert.Equal(t, 4, cfg.Log.Level)
     assert.Equal(t, []string{"group0", "group1", "group2"}, cfg.Limits.Default.Groups)
+    assert.Equal(t, 0.5, cfg.Limits.Policy.Tiers[0.1])
+}
+
+func TestLimitsConfig_GroupIdDefault(t *testing.T) {
+    var lc LimitsConfig
+    _, err := lc.GroupIdDefault()
+    assert.ErrorIs(t, err, ErrNoDefaultGroup)
+    lc.Default.Groups = []string{"group0", "group1"}
+    groupId, err := lc.GroupIdDefault()
+    assert.Nil(t, err)
+    assert.Equal(t, "group0", groupId)
 }
@@ -0,0 +1,168 @@
+package health
+
+import (
+	"context"
+	"github.com/awakari/metrics/util"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+type Status string
+
+const (
+	// StatusUnknown is reported until the first check completes.
+	StatusUnknown Status = "unknown"
+	StatusUp      Status = "up"
+	// StatusDegraded means some optional dependencies are down.
+	StatusDegraded Status = "degraded"
+	StatusDown     Status = "down"
+)
+
+// Probe checks the single dependency and returns the optional detail, e.g. the dependency version.
+type Probe func(ctx context.Context) (detail string, err error)
+
+type Check struct {
+	Name string
+	// Required dependency being down makes the service not ready, the optional one makes it degraded only.
+	Required bool
+	Probe    Probe
+}
+
+type Report struct {
+	Status       Status       `json:"status"`
+	Time         time.Time    `json:"time"`
+	Dependencies []Dependency `json:"dependencies"`
+}
+
+// Dependency is the single check result.
+type Dependency struct {
+	Name     string `json:"name"`
+	Required bool   `json:"required"`
+	// Status is either up or down.
+	Status   Status `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// Ready is true when all the required dependencies are up.
+func (r Report) Ready() bool {
+	return r.Status == StatusUp || r.Status == StatusDegraded
+}
+
+// Checker periodically checks the dependencies.
+type Checker interface {
+
+	// Start checks the dependencies every interval until the context is done and passes every report to the update func.
+	Start(ctx context.Context, update func(r Report))
+
+	// Check runs all the checks at once and returns the report.
+	Check(ctx context.Context) (r Report)
+
+	// Report returns the latest report, the one with the unknown status before the first check.
+	Report() (r Report)
+}
+
+type Config struct {
+	Interval time.Duration
+	// Timeout limits every check.
+	Timeout time.Duration
+}
+
+type checker struct {
+	checks []Check
+	cfg    Config
+	log    *slog.Logger
+	lock   *sync.RWMutex
+	last   Report
+}
+
+func NewChecker(checks []Check, cfg Config, log *slog.Logger) Checker {
+	return &checker{
+		checks: checks,
+		cfg:    cfg,
+		log:    log,
+		lock:   &sync.RWMutex{},
+		last: Report{
+			Status:       StatusUnknown,
+			Dependencies: []Dependency{},
+		},
+	}
+}
+
+func (c *checker) Start(ctx context.Context, update func(r Report)) {
+	tick := time.NewTicker(c.cfg.Interval)
+	defer tick.Stop()
+	for {
+		update(c.Check(ctx))
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+	}
+}
+
+func (c *checker) Check(ctx context.Context) (r Report) {
+	r = Report{
+		Status:       StatusUp,
+		Time:         time.Now().UTC(),
+		Dependencies: make([]Dependency, len(c.checks)),
+	}
+	results := util.FanOut(ctx, c.checks, len(c.checks), c.cfg.Timeout, func(ctx context.Context, chk Check) (d Dependency, err error) {
+		start := time.Now()
+		d.Detail, err = chk.Probe(ctx)
+		d.Duration = time.Since(start).String()
+		return
+	})
+	for i, chk := range c.checks {
+		d := results[i].Out
+		d.Name = chk.Name
+		d.Required = chk.Required
+		d.Status = StatusUp
+		if err := results[i].Err; err != nil {
+			d.Status = StatusDown
+			d.Error = err.Error()
+			switch {
+			case chk.Required:
+				r.Status = StatusDown
+			case r.Status == StatusUp:
+				r.Status = StatusDegraded
+			}
+		}
+		r.Dependencies[i] = d
+	}
+	c.lock.Lock()
+	prev := c.last
+	c.last = r
+	c.lock.Unlock()
+	c.logChanges(ctx, prev, r)
+	return
+}
+
+func (c *checker) logChanges(ctx context.Context, prev, r Report) {
+	statusByNamePrev := make(map[string]Status, len(prev.Dependencies))
+	for _, d := range prev.Dependencies {
+		statusByNamePrev[d.Name] = d.Status
+	}
+	for _, d := range r.Dependencies {
+		switch {
+		case d.Status == statusByNamePrev[d.Name]:
+		case d.Status == StatusUp:
+			c.log.InfoContext(ctx, "dependency is up", "dependency", d.Name, "detail", d.Detail)
+		default:
+			c.log.WarnContext(ctx, "dependency is down", "dependency", d.Name, "required", d.Required, "err", d.Error)
+		}
+	}
+	if r.Status != prev.Status {
+		c.log.InfoContext(ctx, "health status changed", "status", r.Status, "prev", prev.Status)
+	}
+}
+
+func (c *checker) Report() (r Report) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	r = c.last
+	return
+}
@@ -0,0 +1,112 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestChecker_Check(t *testing.T) {
+	up := func(ctx context.Context) (string, error) {
+		return "v1", nil
+	}
+	down := func(ctx context.Context) (string, error) {
+		return "", errors.New("fail")
+	}
+	stuck := func(ctx context.Context) (string, error) {
+		<-ctx.Done()
+		return "", ctx.Err()
+	}
+	cases := map[string]struct {
+		required Probe
+		optional Probe
+		status   Status
+		ready    bool
+		errs     []string
+	}{
+		"up": {
+			required: up,
+			optional: up,
+			status:   StatusUp,
+			ready:    true,
+			errs:     []string{"", ""},
+		},
+		"optional down": {
+			required: up,
+			optional: down,
+			status:   StatusDegraded,
+			ready:    true,
+			errs:     []string{"", "fail"},
+		},
+		"required down": {
+			required: down,
+			optional: up,
+			status:   StatusDown,
+			errs:     []string{"fail", ""},
+		},
+		"required timeout": {
+			required: stuck,
+			optional: down,
+			status:   StatusDown,
+			errs:     []string{"context deadline exceeded", "fail"},
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			chk := NewChecker(
+				[]Check{
+					{
+						Name:     "prometheus",
+						Required: true,
+						Probe:    c.required,
+					},
+					{
+						Name:  "source-feeds",
+						Probe: c.optional,
+					},
+				},
+				Config{
+					Timeout: 10 * time.Millisecond,
+				},
+				slog.New(slog.NewTextHandler(io.Discard, nil)),
+			)
+			assert.Equal(t, StatusUnknown, chk.Report().Status)
+			assert.False(t, chk.Report().Ready())
+			r := chk.Check(context.TODO())
+			assert.Equal(t, c.status, r.Status)
+			assert.Equal(t, c.ready, r.Ready())
+			assert.Equal(t, r, chk.Report())
+			assert.Len(t, r.Dependencies, 2)
+			for i, d := range r.Dependencies {
+				assert.Equal(t, c.errs[i], d.Error)
+				assert.Equal(t, c.errs[i] == "", d.Status == StatusUp)
+			}
+			assert.Equal(t, "prometheus", r.Dependencies[0].Name)
+			assert.True(t, r.Dependencies[0].Required)
+		})
+	}
+}
+
+func TestProbeConn(t *testing.T) {
+	_, err := ProbeConn(nil)(context.TODO())
+	assert.ErrorIs(t, err, ErrNotConnected)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	srv := grpc.NewServer()
+	go srv.Serve(lis)
+	defer srv.Stop()
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.Nil(t, err)
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Second)
+	defer cancel()
+	_, err = ProbeConn(conn)(ctx)
+	assert.Nil(t, err)
+}
@@ -0,0 +1,59 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	apiPromV1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+)
+
+var ErrNotConnected = errors.New("not connected")
+
+// ProbePrometheus requests the Prometheus build and runtime info.
+func ProbePrometheus(api apiPromV1.API) Probe {
+	return func(ctx context.Context) (detail string, err error) {
+		var bi apiPromV1.BuildinfoResult
+		bi, err = api.Buildinfo(ctx)
+		if err != nil {
+			err = fmt.Errorf("build info: %w", err)
+			return
+		}
+		var ri apiPromV1.RuntimeinfoResult
+		ri, err = api.Runtimeinfo(ctx)
+		switch {
+		case err != nil:
+			err = fmt.Errorf("runtime info: %w", err)
+		case !ri.ReloadConfigSuccess:
+			err = errors.New("config reload failed")
+		default:
+			detail = fmt.Sprintf("version %s, retention %s", bi.Version, ri.StorageRetention)
+		}
+		return
+	}
+}
+
+// ProbeConn waits until the connection is ready. The connection is nil when it failed to create.
+// The pooled connections are busy with the requests, so the probe should use the dedicated connection to the same target:
+// taking one from the pool would wait for the free connection under the load and report the healthy dependency down.
+func ProbeConn(conn *grpc.ClientConn) Probe {
+	return func(ctx context.Context) (detail string, err error) {
+		err = probeConn(ctx, conn)
+		return
+	}
+}
+
+func probeConn(ctx context.Context, conn *grpc.ClientConn) (err error) {
+	if conn == nil {
+		return ErrNotConnected
+	}
+	// the idle connection would never become ready otherwise
+	conn.Connect()
+	for state := conn.GetState(); state != connectivity.Ready; state = conn.GetState() {
+		if state == connectivity.Shutdown || !conn.WaitForStateChange(ctx, state) {
+			return fmt.Errorf("%w: %s, target %s", ErrNotConnected, state, conn.Target())
+		}
+	}
+	return
+}
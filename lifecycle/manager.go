@@ -0,0 +1,139 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Manager runs the long-living components and stops these gracefully when the shutdown starts.
+// The components are stopped one by one in the reverse order of the registration, like the deferred calls,
+// so the ones depending on the others should be registered after these.
+type Manager interface {
+
+	// Go runs the component in the background until it returns or it's stopped.
+	// On shutdown, the run context is cancelled and the stop func is called when not nil, then the run return is awaited.
+	// The component failure starts the shutdown.
+	Go(name string, run func(ctx context.Context) (err error), stop func(ctx context.Context) (err error))
+
+	// OnStop registers the func to call on shutdown, e.g. to close the connections.
+	OnStop(name string, stop func(ctx context.Context) (err error))
+
+	// Wait blocks until the context is done or any component fails, then stops all the components within the timeout.
+	// Returns the component failure joined with the stop failures.
+	Wait() (err error)
+}
+
+type component struct {
+	name   string
+	stop   func(ctx context.Context) (err error)
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+type manager struct {
+	ctx        context.Context
+	timeout    time.Duration
+	log        *slog.Logger
+	lock       *sync.Mutex
+	components []component
+	failures   chan error
+}
+
+// NewManager returns the manager starting the shutdown when the ctx is done, e.g. the one from signal.NotifyContext.
+func NewManager(ctx context.Context, timeout time.Duration, log *slog.Logger) Manager {
+	return &manager{
+		ctx:      ctx,
+		timeout:  timeout,
+		log:      log,
+		lock:     &sync.Mutex{},
+		failures: make(chan error, 1),
+	}
+}
+
+func (m *manager) Go(name string, run func(ctx context.Context) (err error), stop func(ctx context.Context) (err error)) {
+	// not derived from the manager's context to stop the components in order
+	ctx, cancel := context.WithCancel(context.Background())
+	c := component{
+		name:   name,
+		stop:   stop,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	m.register(c)
+	go func() {
+		defer close(c.done)
+		err := run(ctx)
+		switch {
+		case err != nil:
+			m.log.Error("component failed", "component", name, "err", err)
+			select {
+			case m.failures <- fmt.Errorf("%s: %w", name, err):
+			default: // the shutdown is already started by the other failure
+			}
+		case ctx.Err() == nil:
+			m.log.Warn("component returned before the shutdown", "component", name)
+		}
+	}()
+}
+
+func (m *manager) OnStop(name string, stop func(ctx context.Context) (err error)) {
+	m.register(component{
+		name: name,
+		stop: stop,
+	})
+}
+
+func (m *manager) register(c component) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.components = append(m.components, c)
+}
+
+func (m *manager) Wait() (err error) {
+	select {
+	case <-m.ctx.Done():
+		m.log.Info("shutting down...", "cause", context.Cause(m.ctx))
+	case err = <-m.failures:
+		m.log.Error("shutting down on failure...", "err", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
+	defer cancel()
+	m.lock.Lock()
+	components := slices.Clone(m.components)
+	m.lock.Unlock()
+	for _, c := range slices.Backward(components) {
+		err = errors.Join(err, m.stop(ctx, c))
+	}
+	m.log.Info("shutdown complete", "err", err)
+	return
+}
+
+func (m *manager) stop(ctx context.Context, c component) (err error) {
+	start := time.Now()
+	if c.cancel != nil {
+		c.cancel()
+	}
+	if c.stop != nil {
+		err = c.stop(ctx)
+	}
+	if c.done != nil {
+		select {
+		case <-c.done:
+		case <-ctx.Done():
+			err = errors.Join(err, fmt.Errorf("not stopped in time: %w", ctx.Err()))
+		}
+	}
+	switch err {
+	case nil:
+		m.log.Debug("component stopped", "component", c.name, "duration", time.Since(start))
+	default:
+		m.log.Warn("component stop failure", "component", c.name, "duration", time.Since(start), "err", err)
+		err = fmt.Errorf("%s: %w", c.name, err)
+	}
+	return
+}
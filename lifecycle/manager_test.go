@@ -0,0 +1,96 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestManager_Wait(t *testing.T) {
+	errFail := errors.New("fail")
+	cases := map[string]struct {
+		fail    bool
+		stuck   bool
+		order   []string
+		errWant []error
+	}{
+		"signal": {
+			order: []string{"health", "server", "server run", "loop run", "pool"},
+		},
+		"failure": {
+			fail: true,
+			// the failed server run returns before the stop
+			order:   []string{"health", "server", "loop run", "pool"},
+			errWant: []error{errFail},
+		},
+		"timeout": {
+			stuck:   true,
+			order:   []string{"health", "server", "server run", "pool"},
+			errWant: []error{context.DeadlineExceeded},
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			lock := &sync.Mutex{}
+			var order []string
+			record := func(name string) {
+				lock.Lock()
+				defer lock.Unlock()
+				order = append(order, name)
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			m := NewManager(ctx, 100*time.Millisecond, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			m.OnStop("pool", func(ctx context.Context) error {
+				record("pool")
+				return nil
+			})
+			m.Go("loop", func(ctx context.Context) error {
+				<-ctx.Done()
+				if c.stuck {
+					time.Sleep(time.Second)
+					return nil
+				}
+				record("loop run")
+				return nil
+			}, nil)
+			stopped := make(chan struct{})
+			m.Go(
+				"server",
+				func(ctx context.Context) error {
+					if c.fail {
+						return errFail
+					}
+					<-stopped
+					record("server run")
+					return nil
+				},
+				func(ctx context.Context) error {
+					record("server")
+					close(stopped)
+					return nil
+				},
+			)
+			m.OnStop("health", func(ctx context.Context) error {
+				record("health")
+				return nil
+			})
+			if !c.fail {
+				cancel()
+			}
+			err := m.Wait()
+			assert.Equal(t, c.order, order)
+			if len(c.errWant) == 0 {
+				assert.Nil(t, err)
+			}
+			for _, errWant := range c.errWant {
+				assert.ErrorIs(t, err, errWant)
+			}
+		})
+	}
+}
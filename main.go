@@ -1,28 +1,51 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"github.com/awakari/metrics/anomaly"
 	apiGrpc "github.com/awakari/metrics/api/grpc"
 	apiGrpcInterests "github.com/awakari/metrics/api/grpc/interests"
 	apiGrpcLimits "github.com/awakari/metrics/api/grpc/limits"
+	apiGrpcSrc "github.com/awakari/metrics/api/grpc/source"
 	apiGrpcSrcAp "github.com/awakari/metrics/api/grpc/source/activitypub"
 	apiGrpcSrcFeeds "github.com/awakari/metrics/api/grpc/source/feeds"
 	apiGrpcSrcSites "github.com/awakari/metrics/api/grpc/source/sites"
 	apiGrpcSrcTg "github.com/awakari/metrics/api/grpc/source/telegram"
 	apiHttp "github.com/awakari/metrics/api/http"
-	apiHttpSrc "github.com/awakari/metrics/api/http/src"
+	apiHttpAnomaly "github.com/awakari/metrics/api/http/anomaly"
+	apiHttpHealth "github.com/awakari/metrics/api/http/health"
+	apiHttpJobs "github.com/awakari/metrics/api/http/jobs"
+	apiHttpLeaderboard "github.com/awakari/metrics/api/http/leaderboard"
+	apiHttpQuery "github.com/awakari/metrics/api/http/query"
+	apiHttpSrc "github.com/awakari/metrics/api/http/source"
+	apiHttpStat "github.com/awakari/metrics/api/http/stat"
+	"github.com/awakari/metrics/catalog"
 	"github.com/awakari/metrics/config"
+	"github.com/awakari/metrics/health"
+	"github.com/awakari/metrics/lifecycle"
+	"github.com/awakari/metrics/scheduler"
 	"github.com/awakari/metrics/service"
+	"github.com/awakari/metrics/tracing"
+	"github.com/awakari/metrics/trending"
+	"github.com/awakari/metrics/util"
 	"github.com/gin-gonic/gin"
 	grpcpool "github.com/processout/grpc-go-pool"
 	apiProm "github.com/prometheus/client_golang/api"
 	apiPromV1 "github.com/prometheus/client_golang/api/prometheus/v1"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 func main() {
@@ -32,10 +55,43 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
-	opts := slog.HandlerOptions{
-		Level: slog.Level(cfg.Log.Level),
+	log, err := util.NewLogger(os.Stdout, cfg.Log.Format, slog.Level(cfg.Log.Level))
+	if err != nil {
+		panic(err)
+	}
+	groupIdDefault, err := cfg.Limits.GroupIdDefault()
+	if err != nil {
+		panic(err)
+	}
+	// the components are stopped in the reverse order of the registration
+	ctxSignal, stopSignal := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stopSignal()
+	lc := lifecycle.NewManager(ctxSignal, cfg.Shutdown.Timeout, log)
+
+	tracingShutdown, err := tracing.Init(context.Background(), tracing.Config{
+		Exporter:    cfg.Tracing.Exporter,
+		Endpoint:    cfg.Tracing.Endpoint,
+		Insecure:    cfg.Tracing.Insecure,
+		Path:        cfg.Tracing.Path,
+		SampleRatio: cfg.Tracing.SampleRatio,
+	})
+	if err != nil {
+		panic(err)
+	}
+	lc.OnStop("tracing", tracingShutdown)
+	// every outgoing call carries the request id, is traced and observed by the downstream service name
+	dialOpts := func(svcName string) []grpc.DialOption {
+		return []grpc.DialOption{
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
+			grpc.WithChainUnaryInterceptor(apiGrpc.NewClientRequestInterceptor(), apiGrpc.NewClientMetricsInterceptor(svcName)),
+		}
+	}
+
+	cat, err := catalog.Load(cfg.Catalog.Path)
+	if err != nil {
+		panic(err)
 	}
-	log := slog.New(slog.NewTextHandler(os.Stdout, &opts))
 
 	clientProm, err := apiProm.NewClient(apiProm.Config{
 		Address: cfg.Api.Prometheus.Uri,
@@ -49,11 +105,22 @@ func main() {
 	}
 
 	svc := service.NewService(ap)
+	svc = service.NewTracing(svc, otel.Tracer(tracing.ServiceName))
+	svc = service.NewInstrumented(svc)
 	svc = service.NewLogging(svc, log)
+	// the anomaly detector compares the current rates, so it bypasses the cache
+	svcUncached := svc
+	svc = service.NewCache(
+		svc,
+		cfg.Api.Prometheus.Cache.Capacity,
+		cfg.Api.Prometheus.Cache.Ttl.Min,
+		cfg.Api.Prometheus.Cache.Ttl.Max,
+		cfg.Api.Prometheus.Timeout,
+	)
 
 	connPoolInterests, err := grpcpool.New(
 		func() (*grpc.ClientConn, error) {
-			return grpc.NewClient(cfg.Api.Interests.Uri, grpc.WithTransportCredentials(insecure.NewCredentials()))
+			return grpc.NewClient(cfg.Api.Interests.Uri, dialOpts("interests")...)
 		},
 		int(cfg.Api.Interests.Connection.Count.Init),
 		int(cfg.Api.Interests.Connection.Count.Max),
@@ -62,53 +129,64 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
-	defer connPoolInterests.Close()
+	lc.OnStop("interests connections", func(ctx context.Context) error {
+		connPoolInterests.Close()
+		return nil
+	})
 	clientInterests := apiGrpcInterests.NewClientPool(connPoolInterests)
 	clientInterests = apiGrpcInterests.NewClientLogging(clientInterests, log)
 
 	// init the source-feeds client
-	connSrcFeeds, err := grpc.NewClient(cfg.Api.Source.Feeds.Uri, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	connSrcFeeds, err := grpc.NewClient(cfg.Api.Source.Feeds.Uri, dialOpts("feeds")...)
 	if err == nil {
 		log.Info("connected the source-feeds service")
-		defer connSrcFeeds.Close()
+		lc.OnStop("source-feeds connection", func(ctx context.Context) error {
+			return connSrcFeeds.Close()
+		})
 	} else {
-		log.Error(fmt.Sprintf("failed to connect the source-feeds service: %s", err))
+		log.Error("failed to connect the source-feeds service", "err", err)
 	}
 	clientSrcFeeds := apiGrpcSrcFeeds.NewServiceClient(connSrcFeeds)
 	svcSrcFeeds := apiGrpcSrcFeeds.NewService(clientSrcFeeds)
 	svcSrcFeeds = apiGrpcSrcFeeds.NewServiceLogging(svcSrcFeeds, log)
 
 	// init the source-telegram client
-	connSrcTg, err := grpc.NewClient(cfg.Api.Source.Telegram.Uri, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	connSrcTg, err := grpc.NewClient(cfg.Api.Source.Telegram.Uri, dialOpts("telegram")...)
 	if err == nil {
 		log.Info("connected the source-telegram service")
-		defer connSrcTg.Close()
+		lc.OnStop("source-telegram connection", func(ctx context.Context) error {
+			return connSrcTg.Close()
+		})
 	} else {
-		log.Error(fmt.Sprintf("failed to connect the source-telegram service: %s", err))
+		log.Error("failed to connect the source-telegram service", "err", err)
 	}
 	clientSrcTg := apiGrpcSrcTg.NewServiceClient(connSrcTg)
 	svcSrcTg := apiGrpcSrcTg.NewService(clientSrcTg)
 	svcSrcTg = apiGrpcSrcTg.NewServiceLogging(svcSrcTg, log)
 
 	// init the source-sites client
-	connSrcSites, err := grpc.NewClient(cfg.Api.Source.Sites.Uri, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	connSrcSites, err := grpc.NewClient(cfg.Api.Source.Sites.Uri, dialOpts("sites")...)
 	if err == nil {
 		log.Info("connected the source-sites service")
-		defer connSrcSites.Close()
+		lc.OnStop("source-sites connection", func(ctx context.Context) error {
+			return connSrcSites.Close()
+		})
 	} else {
-		log.Error(fmt.Sprintf("failed to connect the source-sites service: %s", err))
+		log.Error("failed to connect the source-sites service", "err", err)
 	}
 	clientSrcSites := apiGrpcSrcSites.NewServiceClient(connSrcSites)
 	svcSrcSites := apiGrpcSrcSites.NewService(clientSrcSites)
 	svcSrcSites = apiGrpcSrcSites.NewServiceLogging(svcSrcSites, log)
 
 	// init the int-activitypub client
-	connSrcAp, err := grpc.NewClient(cfg.Api.Source.ActivityPub.Uri, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	connSrcAp, err := grpc.NewClient(cfg.Api.Source.ActivityPub.Uri, dialOpts("activitypub")...)
 	if err == nil {
 		log.Info("connected the int-activitypub service")
-		defer connSrcAp.Close()
+		lc.OnStop("int-activitypub connection", func(ctx context.Context) error {
+			return connSrcAp.Close()
+		})
 	} else {
-		log.Error(fmt.Sprintf("failed to connect the int-activitypub service: %s", err))
+		log.Error("failed to connect the int-activitypub service", "err", err)
 	}
 	clientSrcAp := apiGrpcSrcAp.NewServiceClient(connSrcAp)
 	svcSrcAp := apiGrpcSrcAp.NewService(clientSrcAp)
@@ -116,7 +194,7 @@ func main() {
 
 	connPoolLimits, err := grpcpool.New(
 		func() (*grpc.ClientConn, error) {
-			return grpc.NewClient(cfg.Api.Usage.Uri, grpc.WithTransportCredentials(insecure.NewCredentials()))
+			return grpc.NewClient(cfg.Api.Usage.Uri, dialOpts("usage")...)
 		},
 		int(cfg.Api.Usage.Connection.Count.Init),
 		int(cfg.Api.Usage.Connection.Count.Max),
@@ -125,57 +203,298 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
-	defer connPoolLimits.Close()
+	lc.OnStop("usage connections", func(ctx context.Context) error {
+		connPoolLimits.Close()
+		return nil
+	})
 	clientLimits := apiGrpcLimits.NewClientPool(connPoolLimits)
 	svcLimits := apiGrpcLimits.NewService(clientLimits)
 	svcLimits = apiGrpcLimits.NewServiceLogging(svcLimits, log)
 
+	// the dependencies are probed by the dedicated connections, not the pooled ones busy with the requests
+	connProbeInterests, err := grpc.NewClient(cfg.Api.Interests.Uri, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err == nil {
+		lc.OnStop("interests probe connection", func(ctx context.Context) error {
+			return connProbeInterests.Close()
+		})
+	} else {
+		log.Error("failed to connect the interests service for probing", "err", err)
+	}
+	connProbeUsage, err := grpc.NewClient(cfg.Api.Usage.Uri, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err == nil {
+		lc.OnStop("usage probe connection", func(ctx context.Context) error {
+			return connProbeUsage.Close()
+		})
+	} else {
+		log.Error("failed to connect the usage service for probing", "err", err)
+	}
+	// the source services are optional: the service is degraded only when these are down.
+	// Prometheus is optional too: it's shared by all the replicas, so its outage would make every replica not ready at once,
+	// while the cached responses and the routes not querying it may still be served.
+	checker := health.NewChecker(
+		[]health.Check{
+			{
+				Name:  "prometheus",
+				Probe: health.ProbePrometheus(ap),
+			},
+			{
+				Name:     "interests",
+				Required: true,
+				Probe:    health.ProbeConn(connProbeInterests),
+			},
+			{
+				Name:     "usage",
+				Required: true,
+				Probe:    health.ProbeConn(connProbeUsage),
+			},
+			{
+				Name:  "source-feeds",
+				Probe: health.ProbeConn(connSrcFeeds),
+			},
+			{
+				Name:  "source-telegram",
+				Probe: health.ProbeConn(connSrcTg),
+			},
+			{
+				Name:  "source-sites",
+				Probe: health.ProbeConn(connSrcSites),
+			},
+			{
+				Name:  "int-activitypub",
+				Probe: health.ProbeConn(connSrcAp),
+			},
+		},
+		health.Config{
+			Interval: cfg.Health.Interval,
+			Timeout:  cfg.Health.Timeout,
+		},
+		log,
+	)
+
 	handlerCookies := apiHttp.NewCookieHandler(cfg.Api.Http.Cookie)
+	resolver := apiGrpcSrc.NewResolver(svcSrcFeeds, svcSrcSites, svcSrcTg, svcSrcAp, cfg.Api.Source.Cache.Capacity, cfg.Api.Source.Cache.Ttl)
+	validator := apiHttp.NewValidator(cfg.Api.Period)
 
-	r := gin.Default()
-	handlerStatus := apiHttp.NewHandler(svc, clientInterests, cfg.Limits.Default.Groups)
+	r := gin.New()
+	r.Use(otelgin.Middleware(tracing.ServiceName), apiHttp.ObserveRequest, apiHttp.NewRequestLogger(log).Handle, gin.Recovery())
+	// make the request id available via the gin context to the services called with it
+	r.ContextWithFallback = true
+	handlerHealth := apiHttpHealth.NewHandler(checker)
+	r.GET("/healthz", handlerHealth.Live)
+	r.GET("/readyz", handlerHealth.Ready)
+	handlerStatus := apiHttp.NewHandler(svc, cat.Metrics)
 	r.
 		Group("/v1/public", handlerCookies.Handle).
-		GET("/pub-rate/:period", handlerStatus.GetPublishRate).
-		GET("/read/:period", handlerStatus.GetReadStatus).
-		GET("/followers", handlerStatus.GetFollowersCount).
-		GET("/top-interests", handlerStatus.GetTopInterests).
-		GET("/new-interests", handlerStatus.GetNewInterests).
+		GET("/read/:period", validator.Period, handlerStatus.GetReadStatus).
 		GET("/duration", handlerStatus.GetCoreDuration)
+	var trendingStore trending.Store
+	switch cfg.Trending.Path {
+	case "":
+		trendingStore = trending.NewStoreMemory()
+	default:
+		trendingStore, err = trending.NewStoreFile(cfg.Trending.Path)
+		if err != nil {
+			panic(err)
+		}
+	}
+	tracker := trending.NewTracker(
+		clientInterests,
+		groupIdDefault,
+		trendingStore,
+		trending.Config{
+			Interval:        cfg.Trending.Interval,
+			Top:             cfg.Trending.Top,
+			ReadParallelism: cfg.Api.Interests.Read.Parallelism,
+			ReadTimeout:     cfg.Api.Interests.Read.Timeout,
+		},
+		log,
+	)
+	lc.Go("trending", func(ctx context.Context) error {
+		tracker.Start(ctx)
+		return nil
+	}, nil)
+	handlerLeaderboard := apiHttpLeaderboard.NewHandler(clientInterests, tracker, groupIdDefault, cfg.Api.Interests.Read.Parallelism, cfg.Api.Interests.Read.Timeout)
+	r.
+		Group("/v1/public/interests", handlerCookies.Handle).
+		GET("/top", handlerLeaderboard.GetTop).
+		GET("/new", handlerLeaderboard.GetNew).
+		GET("/trending", handlerLeaderboard.GetTrending)
+	r.
+		Group("/v1/public", handlerCookies.Handle).
+		GET("/top-interests", handlerLeaderboard.GetTopLegacy).
+		GET("/new-interests", handlerLeaderboard.GetNewLegacy)
 	r.
 		Group("/v1/attr", handlerCookies.Handle).
 		GET("/types", handlerStatus.GetEventAttributeTypes).
-		GET("/values/:name", handlerStatus.GetEventAttributeValuesByName)
-
-	handlerSrc := apiHttpSrc.NewHandler(svc)
+		GET("/values/:name", validator.AttrName, handlerStatus.GetEventAttributeValuesByName)
+	for _, stat := range cat.Stats {
+		r.
+			Group(stat.Group, handlerCookies.Handle).
+			GET(stat.Path, validator.Period, apiHttpStat.NewHandler(svc, stat).Handle)
+	}
+	handlerQuery := apiHttpQuery.NewHandler(svc, cat.Query.Metrics)
+	detector := anomaly.NewDetector(
+		svcUncached,
+		map[string]string{
+			"publish": cat.Metrics.PublishedEvents,
+			"read":    cat.Metrics.ReadCount,
+		},
+		anomaly.Config{
+			Interval:  cfg.Anomaly.Interval,
+			Window:    cfg.Anomaly.Window,
+			Weeks:     cfg.Anomaly.Weeks,
+			Threshold: cfg.Anomaly.Threshold,
+			MinChange: cfg.Anomaly.MinChange,
+		},
+		log,
+	)
+	lc.Go("anomaly detector", func(ctx context.Context) error {
+		detector.Start(ctx)
+		return nil
+	}, nil)
+	handlerAnomaly := apiHttpAnomaly.NewHandler(detector)
+	r.
+		Group("/v1", handlerCookies.Handle).
+		GET("/query", validator.Period, handlerQuery.Query).
+		GET("/anomalies", handlerAnomaly.Get)
+	handlerSrc := apiHttpSrc.NewHandler(svc, svcLimits, resolver, groupIdDefault, cat.Metrics)
 	r.
 		Group("/v1/src", handlerCookies.Handle).
-		GET("/feeds", handlerSrc.FeedCount).
-		GET("/socials", handlerSrc.SocialCount).
-		GET("/realtime", handlerSrc.RealtimeCount)
-	go func() {
-		err = r.Run(fmt.Sprintf(":%d", cfg.Api.Http.Port))
-		if err != nil {
-			panic(err)
-		}
-	}()
-
-	go func() {
-		http.Handle("/metrics", promhttp.Handler())
-		http.ListenAndServe(fmt.Sprintf(":%d", cfg.Api.Metrics.Port), nil)
-	}()
+		GET("/stats", validator.Source, validator.Period, handlerSrc.GetStats)
+	srvHttp := &http.Server{
+		Addr:    fmt.Sprintf(":%d", cfg.Api.Http.Port),
+		Handler: r,
+	}
+	lc.Go("http", func(ctx context.Context) error {
+		return listenAndServe(srvHttp)
+	}, srvHttp.Shutdown)
 
-	log.Info(fmt.Sprintf("starting to listen the API @ port #%d...", cfg.Api.Port))
-	err = apiGrpc.Serve(
-		cfg,
+	limitPolicies, err := apiGrpc.NewLimitPolicies(
+		apiGrpc.LimitBounds{
+			MinHourly: cfg.Limits.Default.User.Publish.Hourly,
+			MinDaily:  cfg.Limits.Default.User.Publish.Daily,
+			MaxHourly: cfg.Limits.Max.User.Publish.Hourly,
+			MaxDaily:  cfg.Limits.Max.User.Publish.Daily,
+		},
+		cfg.Limits.Policy,
+	)
+	if err != nil {
+		panic(err)
+	}
+	controllerGrpc := apiGrpc.NewController(
 		svcLimits,
 		svc,
-		svcSrcFeeds,
-		svcSrcSites,
-		svcSrcTg,
+		limitPolicies,
+		cfg.Limits.Policy.Expiration,
+		cfg.Limits.Update.Parallelism,
+		cfg.Limits.Update.CallTimeout,
+		resolver,
 		svcSrcAp,
+		tracker,
+		groupIdDefault,
+		cat.Metrics,
+		cfg.Api.Period.Min,
+		cfg.Api.Period.Max,
+		log,
+	)
+
+	// the pod name is the hostname
+	hostname, _ := os.Hostname()
+	schedLockHolder := fmt.Sprintf("%s-%d", hostname, os.Getpid())
+	schedLockFileDir := cfg.Scheduler.Lock.File.Dir
+	if schedLockFileDir == "" {
+		schedLockFileDir = os.TempDir()
+	}
+	var schedLock scheduler.Lock
+	switch cfg.Scheduler.Lock.Type {
+	case "none":
+		schedLock = scheduler.NewLockNone()
+	case "file":
+		schedLock = scheduler.NewLockFile(schedLockFileDir, schedLockHolder)
+	case "lease":
+		schedLock, err = scheduler.NewLockLeaseInCluster(cfg.Scheduler.Lock.Lease.Namespace, schedLockHolder)
+		if errors.Is(err, scheduler.ErrNotInCluster) {
+			log.Warn("scheduler lease lock is not available, falling back to the file lock", "dir", schedLockFileDir, "err", err)
+			schedLock = scheduler.NewLockFile(schedLockFileDir, schedLockHolder)
+			err = nil
+		}
+		if err != nil {
+			panic(err)
+		}
+	default:
+		panic(fmt.Sprintf("unknown scheduler lock type: %s", cfg.Scheduler.Lock.Type))
+	}
+	sched, err := scheduler.NewScheduler(
+		[]scheduler.Job{
+			{
+				Name:     "limits-most-read",
+				Schedule: cfg.Scheduler.Limits.Schedule,
+				Timeout:  cfg.Scheduler.Limits.Timeout,
+				Run: func(ctx context.Context) (err error) {
+					var resp *apiGrpc.SetMostReadLimitsResponse
+					resp, err = controllerGrpc.SetMostReadLimits(ctx, &apiGrpc.SetMostReadLimitsRequest{})
+					if err == nil && resp.Incomplete {
+						err = fmt.Errorf("incomplete, %d sources remaining", resp.SourcesRemaining)
+					}
+					return
+				},
+			},
+		},
+		schedLock,
+		cfg.Scheduler.ReplicasMax,
+		log,
 	)
 	if err != nil {
 		panic(err)
 	}
+	lc.Go("scheduler", func(ctx context.Context) error {
+		sched.Start(ctx)
+		return nil
+	}, nil)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.Handle("/jobs", apiHttpJobs.NewHandler(sched))
+	srvMetrics := &http.Server{
+		Addr:    fmt.Sprintf(":%d", cfg.Api.Metrics.Port),
+		Handler: mux,
+	}
+	lc.Go("metrics http", func(ctx context.Context) error {
+		return listenAndServe(srvMetrics)
+	}, srvMetrics.Shutdown)
+
+	log.Info("starting to listen the API...", "port", cfg.Api.Port)
+	srvGrpc := apiGrpc.NewServer(controllerGrpc, log)
+	lc.Go("grpc", func(ctx context.Context) error {
+		return srvGrpc.Serve(cfg.Api.Port)
+	}, srvGrpc.Stop)
+	lc.Go("health checks", func(ctx context.Context) error {
+		checker.Start(ctx, srvGrpc.SetHealth)
+		return nil
+	}, nil)
+	// stopped first: the clients stop sending the new requests before the servers are drained
+	lc.OnStop("health", func(ctx context.Context) (err error) {
+		srvGrpc.SetNotServing()
+		select {
+		case <-time.After(cfg.Shutdown.Delay):
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+		return
+	})
+
+	err = lc.Wait()
+	if err != nil {
+		log.Error("stopped with failures", "err", err)
+		os.Exit(1)
+	}
+}
+
+// listenAndServe treats the server shutdown as the normal completion.
+func listenAndServe(srv *http.Server) (err error) {
+	err = srv.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		err = nil
+	}
+	return
 }
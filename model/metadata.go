@@ -2,3 +2,4 @@ package model
 
 const KeyGroupId = "x-awakari-group-id"
 const KeyUserId = "x-awakari-user-id"
+const KeyRequestId = "x-request-id"
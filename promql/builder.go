@@ -0,0 +1,131 @@
+package promql
+
+import (
+	"errors"
+	"fmt"
+	"github.com/prometheus/common/model"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type Aggregation string
+
+const (
+	AggregationSum   Aggregation = "sum"
+	AggregationAvg   Aggregation = "avg"
+	AggregationMin   Aggregation = "min"
+	AggregationMax   Aggregation = "max"
+	AggregationCount Aggregation = "count"
+)
+
+// Metric describes the metric allowed to be queried.
+type Metric struct {
+	Name string `yaml:"name"`
+	// Counter metrics are queried as a rate over the period.
+	Counter bool `yaml:"counter"`
+	// Labels allowed to be used for grouping and filtering.
+	Labels []string `yaml:"labels"`
+}
+
+// Spec is the query specification supplied by a client. It never contains any raw PromQL.
+type Spec struct {
+	Metric      string
+	Aggregation Aggregation
+	By          []string
+	Filters     map[string]string
+	Period      string
+}
+
+var ErrInvalid = errors.New("invalid query")
+
+var patternName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+var patternValue = regexp.MustCompile(`^[\p{L}\p{N} _.,:;/@#%&=+*?!~()-]*$`)
+
+const valueLenMax = 256
+
+// ValidName returns true if the string is a valid Prometheus metric or label name.
+func ValidName(name string) bool {
+	return patternName.MatchString(name)
+}
+
+// ValidateMetric checks the whitelist entry.
+func ValidateMetric(m Metric) (err error) {
+	if !ValidName(m.Name) {
+		err = fmt.Errorf("%w: metric name %q", ErrInvalid, m.Name)
+	}
+	for _, l := range m.Labels {
+		if err == nil && !ValidName(l) {
+			err = fmt.Errorf("%w: metric %s label name %q", ErrInvalid, m.Name, l)
+		}
+	}
+	return
+}
+
+// LabelMatcher returns the equality matcher for the label, e.g. source="https://example.com/feed.xml".
+func LabelMatcher(name, value string) (m string, err error) {
+	switch {
+	case !ValidName(name):
+		err = fmt.Errorf("%w: label name %q", ErrInvalid, name)
+	case len(value) > valueLenMax || !patternValue.MatchString(value):
+		err = fmt.Errorf("%w: label %s value %q", ErrInvalid, name, value)
+	default:
+		m = name + "=" + strconv.Quote(value)
+	}
+	return
+}
+
+// Build returns the PromQL query for the spec, if the spec matches the whitelist.
+func Build(spec Spec, whitelist []Metric) (q string, err error) {
+	i := slices.IndexFunc(whitelist, func(m Metric) bool {
+		return m.Name == spec.Metric
+	})
+	if i < 0 {
+		err = fmt.Errorf("%w: metric %q is not allowed", ErrInvalid, spec.Metric)
+		return
+	}
+	m := whitelist[i]
+	switch spec.Aggregation {
+	case AggregationSum, AggregationAvg, AggregationMin, AggregationMax, AggregationCount:
+	default:
+		err = fmt.Errorf("%w: aggregation %q", ErrInvalid, spec.Aggregation)
+		return
+	}
+	for _, l := range spec.By {
+		if !slices.Contains(m.Labels, l) {
+			err = fmt.Errorf("%w: label %q is not allowed for metric %s", ErrInvalid, l, m.Name)
+			return
+		}
+	}
+	var matchers []string
+	for l, v := range spec.Filters {
+		if !slices.Contains(m.Labels, l) {
+			err = fmt.Errorf("%w: label %q is not allowed for metric %s", ErrInvalid, l, m.Name)
+			return
+		}
+		var matcher string
+		matcher, err = LabelMatcher(l, v)
+		if err != nil {
+			return
+		}
+		matchers = append(matchers, matcher)
+	}
+	sort.Strings(matchers)
+	selector := m.Name
+	if len(matchers) > 0 {
+		selector += "{" + strings.Join(matchers, ",") + "}"
+	}
+	if m.Counter {
+		var period model.Duration
+		period, err = model.ParseDuration(spec.Period)
+		if err != nil || period <= 0 {
+			err = fmt.Errorf("%w: period %q", ErrInvalid, spec.Period)
+			return
+		}
+		selector = fmt.Sprintf("rate(%s[%s])", selector, period)
+	}
+	q = fmt.Sprintf("%s by (%s) (%s)", spec.Aggregation, strings.Join(spec.By, ", "), selector)
+	return
+}
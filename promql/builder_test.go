@@ -0,0 +1,112 @@
+package promql
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestBuild(t *testing.T) {
+	whitelist := []Metric{
+		{
+			Name:    "metric_count",
+			Counter: true,
+			Labels:  []string{"service", "source"},
+		},
+		{
+			Name: "metric_gauge",
+		},
+	}
+	cases := map[string]struct {
+		spec Spec
+		q    string
+		err  error
+	}{
+		"counter": {
+			spec: Spec{
+				Metric:      "metric_count",
+				Aggregation: AggregationSum,
+				By:          []string{"service"},
+				Filters: map[string]string{
+					"source":  "https://example.com/feed",
+					"service": "int-activitypub",
+				},
+				Period: "1d",
+			},
+			q: `sum by (service) (rate(metric_count{service="int-activitypub",source="https://example.com/feed"}[1d]))`,
+		},
+		"gauge": {
+			spec: Spec{
+				Metric:      "metric_gauge",
+				Aggregation: AggregationMax,
+			},
+			q: `max by () (metric_gauge)`,
+		},
+		"metric not allowed": {
+			spec: Spec{
+				Metric:      "up",
+				Aggregation: AggregationSum,
+			},
+			err: ErrInvalid,
+		},
+		"metric injection": {
+			spec: Spec{
+				Metric:      "metric_gauge or up",
+				Aggregation: AggregationSum,
+			},
+			err: ErrInvalid,
+		},
+		"aggregation not allowed": {
+			spec: Spec{
+				Metric:      "metric_gauge",
+				Aggregation: "topk(1, up) or sum",
+			},
+			err: ErrInvalid,
+		},
+		"group label not allowed": {
+			spec: Spec{
+				Metric:      "metric_count",
+				Aggregation: AggregationSum,
+				By:          []string{"instance"},
+				Period:      "1h",
+			},
+			err: ErrInvalid,
+		},
+		"filter label not allowed": {
+			spec: Spec{
+				Metric:      "metric_count",
+				Aggregation: AggregationSum,
+				Filters: map[string]string{
+					"instance": "foo",
+				},
+				Period: "1h",
+			},
+			err: ErrInvalid,
+		},
+		"filter value injection": {
+			spec: Spec{
+				Metric:      "metric_count",
+				Aggregation: AggregationSum,
+				Filters: map[string]string{
+					"source": `x"} or up{a="`,
+				},
+				Period: "1h",
+			},
+			err: ErrInvalid,
+		},
+		"period injection": {
+			spec: Spec{
+				Metric:      "metric_count",
+				Aggregation: AggregationSum,
+				Period:      "1h]) or up or rate(x[1h",
+			},
+			err: ErrInvalid,
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			q, err := Build(c.spec, whitelist)
+			assert.Equal(t, c.q, q)
+			assert.ErrorIs(t, err, c.err)
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package promql
+
+import (
+	"fmt"
+	"github.com/prometheus/common/model"
+	"time"
+)
+
+// ParsePeriod parses the Prometheus duration (e.g. "90s", "1h30m", "1d", "1w") and checks it's within the bounds.
+// The returned period is in the canonical form, so "60m" becomes "1h".
+func ParsePeriod(s string, min, max time.Duration) (period string, err error) {
+	var d model.Duration
+	d, err = model.ParseDuration(s)
+	switch {
+	case err != nil:
+		err = fmt.Errorf("%w: period %q: %s", ErrInvalid, s, err)
+	case time.Duration(d) < min:
+		err = fmt.Errorf("%w: period %s is less than %s", ErrInvalid, d, model.Duration(min))
+	case time.Duration(d) > max:
+		err = fmt.Errorf("%w: period %s is more than %s", ErrInvalid, d, model.Duration(max))
+	default:
+		period = d.String()
+	}
+	return
+}
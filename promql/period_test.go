@@ -0,0 +1,32 @@
+package promql
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestParsePeriod(t *testing.T) {
+	cases := map[string]struct {
+		period string
+		err    error
+	}{
+		"1h":                 {period: "1h"},
+		"60m":                {period: "1h"},
+		"1d":                 {period: "1d"},
+		"1w":                 {period: "1w"},
+		"1h30m":              {period: "1h30m"},
+		"":                   {err: ErrInvalid},
+		"10s":                {err: ErrInvalid},
+		"1y":                 {err: ErrInvalid},
+		"-1h":                {err: ErrInvalid},
+		"1h])) or vector(1)": {err: ErrInvalid},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			period, err := ParsePeriod(k, time.Minute, 30*24*time.Hour)
+			assert.Equal(t, c.period, period)
+			assert.ErrorIs(t, err, c.err)
+		})
+	}
+}
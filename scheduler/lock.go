@@ -0,0 +1,359 @@
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Lock ensures the job runs only on one replica at a time.
+type Lock interface {
+
+	// TryAcquire takes the named lock for the given duration at most.
+	// Returns false when the lock is held by another holder.
+	TryAcquire(ctx context.Context, name string, ttl time.Duration) (acquired bool, err error)
+
+	// Release frees the named lock held by this holder.
+	Release(ctx context.Context, name string) (err error)
+}
+
+type lockNone struct {
+}
+
+// NewLockNone returns the lock that is always acquired. Use it only when there's a single replica.
+func NewLockNone() Lock {
+	return lockNone{}
+}
+
+func (l lockNone) TryAcquire(ctx context.Context, name string, ttl time.Duration) (acquired bool, err error) {
+	acquired = true
+	return
+}
+
+func (l lockNone) Release(ctx context.Context, name string) (err error) {
+	return
+}
+
+type lockFile struct {
+	dir    string
+	holder string
+}
+
+// NewLockFile returns the lock based on the files in the directory, one per job.
+// The directory should be shared by all replicas, e.g. the local directory when running outside the cluster.
+// The file is never removed, it contains the holder and the expiration time, both changed under the exclusive flock only,
+// so the lock abandoned by the crashed holder is taken over once it expires.
+func NewLockFile(dir, holder string) Lock {
+	return lockFile{
+		dir:    dir,
+		holder: holder,
+	}
+}
+
+func (l lockFile) TryAcquire(ctx context.Context, name string, ttl time.Duration) (acquired bool, err error) {
+	acquired, err = l.update(name, func(holder string, expires time.Time) (next string, ok bool) {
+		now := time.Now()
+		// free, this holder's one or abandoned
+		ok = holder == "" || holder == l.holder || !expires.After(now)
+		next = fmt.Sprintf("%s\n%d\n", l.holder, now.Add(ttl).UnixNano())
+		return
+	})
+	return
+}
+
+func (l lockFile) Release(ctx context.Context, name string) (err error) {
+	var released bool
+	released, err = l.update(name, func(holder string, expires time.Time) (next string, ok bool) {
+		ok = holder == l.holder
+		return
+	})
+	if err == nil && !released {
+		err = fmt.Errorf("lock %s is not held by %s", name, l.holder)
+	}
+	return
+}
+
+// update replaces the lock file contents with the next ones when ok, under the exclusive flock held only for the update.
+func (l lockFile) update(name string, f func(holder string, expires time.Time) (next string, ok bool)) (ok bool, err error) {
+	var file *os.File
+	file, err = os.OpenFile(filepath.Join(l.dir, name+".lock"), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	fd := int(file.Fd())
+	err = syscall.Flock(fd, syscall.LOCK_EX)
+	if err != nil {
+		return
+	}
+	defer syscall.Flock(fd, syscall.LOCK_UN)
+	var data []byte
+	data, err = io.ReadAll(file)
+	if err != nil {
+		return
+	}
+	// the incomplete contents left by the holder crashed while writing are treated as free
+	var holder string
+	var expires time.Time
+	if lines := strings.Split(string(data), "\n"); len(lines) > 2 {
+		if nanos, errParse := strconv.ParseInt(lines[1], 10, 64); errParse == nil {
+			holder = lines[0]
+			expires = time.Unix(0, nanos)
+		}
+	}
+	var next string
+	next, ok = f(holder, expires)
+	if ok {
+		err = file.Truncate(0)
+		if err == nil {
+			_, err = file.WriteAt([]byte(next), 0)
+		}
+		if err == nil {
+			err = file.Sync()
+		}
+		ok = err == nil
+	}
+	return
+}
+
+type lockLease struct {
+	client    *http.Client
+	baseUrl   string
+	tokenPath string
+	namespace string
+	holder    string
+}
+
+type lease struct {
+	ApiVersion string        `json:"apiVersion"`
+	Kind       string        `json:"kind"`
+	Metadata   leaseMetadata `json:"metadata"`
+	Spec       leaseSpec     `json:"spec"`
+}
+
+type leaseMetadata struct {
+	Name            string `json:"name"`
+	Namespace       string `json:"namespace"`
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+}
+
+type leaseSpec struct {
+	HolderIdentity       string `json:"holderIdentity,omitempty"`
+	LeaseDurationSeconds int32  `json:"leaseDurationSeconds,omitempty"`
+	AcquireTime          string `json:"acquireTime,omitempty"`
+	RenewTime            string `json:"renewTime,omitempty"`
+}
+
+// leaseNamePrefix distinguishes the job leases from the other ones in the namespace.
+const leaseNamePrefix = "metrics-job-"
+
+// fmtMicroTime is the Kubernetes MicroTime format.
+const fmtMicroTime = "2006-01-02T15:04:05.000000Z07:00"
+
+const pathServiceAccount = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+var ErrNotInCluster = errors.New("not running in the Kubernetes cluster")
+
+// NewLockLease returns the lock based on the Kubernetes coordination leases in the namespace, one per job.
+// Every lease change is conditional on the resource version read before,
+// so only one of the replicas competing for the same lease may take it.
+// The token is read from the file on every request, as the service account tokens are rotated.
+func NewLockLease(client *http.Client, baseUrl, tokenPath, namespace, holder string) Lock {
+	return lockLease{
+		client:    client,
+		baseUrl:   baseUrl,
+		tokenPath: tokenPath,
+		namespace: namespace,
+		holder:    holder,
+	}
+}
+
+// NewLockLeaseInCluster returns the lease lock using the pod service account.
+// The namespace is the pod's one when empty.
+func NewLockLeaseInCluster(namespace, holder string) (l Lock, err error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		err = ErrNotInCluster
+		return
+	}
+	var ca []byte
+	ca, err = os.ReadFile(pathServiceAccount + "/ca.crt")
+	if err != nil {
+		err = fmt.Errorf("%w: %s", ErrNotInCluster, err)
+		return
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		err = fmt.Errorf("%w: invalid service account CA", ErrNotInCluster)
+		return
+	}
+	if namespace == "" {
+		var data []byte
+		data, err = os.ReadFile(pathServiceAccount + "/namespace")
+		if err != nil {
+			err = fmt.Errorf("%w: %s", ErrNotInCluster, err)
+			return
+		}
+		namespace = strings.TrimSpace(string(data))
+	}
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				RootCAs: pool,
+			},
+		},
+	}
+	l = NewLockLease(client, "https://"+net.JoinHostPort(host, port), pathServiceAccount+"/token", namespace, holder)
+	return
+}
+
+func (l lockLease) TryAcquire(ctx context.Context, name string, ttl time.Duration) (acquired bool, err error) {
+	var prev lease
+	var found bool
+	prev, found, err = l.get(ctx, name)
+	now := time.Now().UTC()
+	next := l.lease(name)
+	next.Spec = leaseSpec{
+		HolderIdentity:       l.holder,
+		LeaseDurationSeconds: int32(max(1, math.Ceil(ttl.Seconds()))),
+		AcquireTime:          now.Format(fmtMicroTime),
+		RenewTime:            now.Format(fmtMicroTime),
+	}
+	switch {
+	case err != nil:
+	case !found:
+		acquired, err = l.write(ctx, http.MethodPost, l.url(""), next)
+	case prev.Spec.HolderIdentity != l.holder && prev.held(now):
+	default:
+		// free, expired or this holder's one
+		next.Metadata.ResourceVersion = prev.Metadata.ResourceVersion
+		acquired, err = l.write(ctx, http.MethodPut, l.url(name), next)
+	}
+	return
+}
+
+func (l lockLease) Release(ctx context.Context, name string) (err error) {
+	var prev lease
+	var found bool
+	prev, found, err = l.get(ctx, name)
+	switch {
+	case err != nil:
+	case !found, prev.Spec.HolderIdentity != l.holder:
+		err = fmt.Errorf("lock %s is not held by %s", name, l.holder)
+	default:
+		next := l.lease(name)
+		next.Metadata.ResourceVersion = prev.Metadata.ResourceVersion
+		var released bool
+		released, err = l.write(ctx, http.MethodPut, l.url(name), next)
+		if err == nil && !released {
+			err = fmt.Errorf("lock %s was changed concurrently", name)
+		}
+	}
+	return
+}
+
+func (le lease) held(now time.Time) (held bool) {
+	renewed, err := time.Parse(time.RFC3339Nano, le.Spec.RenewTime)
+	if le.Spec.HolderIdentity != "" && err == nil {
+		held = renewed.Add(time.Duration(le.Spec.LeaseDurationSeconds) * time.Second).After(now)
+	}
+	return
+}
+
+func (l lockLease) lease(name string) lease {
+	return lease{
+		ApiVersion: "coordination.k8s.io/v1",
+		Kind:       "Lease",
+		Metadata: leaseMetadata{
+			Name:      leaseNamePrefix + name,
+			Namespace: l.namespace,
+		},
+	}
+}
+
+func (l lockLease) url(name string) (u string) {
+	u = fmt.Sprintf("%s/apis/coordination.k8s.io/v1/namespaces/%s/leases", l.baseUrl, url.PathEscape(l.namespace))
+	if name != "" {
+		u += "/" + url.PathEscape(leaseNamePrefix+name)
+	}
+	return
+}
+
+func (l lockLease) get(ctx context.Context, name string) (le lease, found bool, err error) {
+	var resp *http.Response
+	resp, err = l.do(ctx, http.MethodGet, l.url(name), nil)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		found = true
+		err = json.NewDecoder(resp.Body).Decode(&le)
+	case http.StatusNotFound:
+	default:
+		err = unexpectedStatus(resp)
+	}
+	return
+}
+
+// write returns false when the lease was changed or created concurrently by another holder.
+func (l lockLease) write(ctx context.Context, method, u string, le lease) (ok bool, err error) {
+	var data []byte
+	data, err = json.Marshal(le)
+	var resp *http.Response
+	if err == nil {
+		resp, err = l.do(ctx, method, u, data)
+	}
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		ok = true
+	case http.StatusConflict:
+	default:
+		err = unexpectedStatus(resp)
+	}
+	return
+}
+
+func (l lockLease) do(ctx context.Context, method, u string, body []byte) (resp *http.Response, err error) {
+	var req *http.Request
+	req, err = http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	var token []byte
+	if err == nil {
+		token, err = os.ReadFile(l.tokenPath)
+	}
+	if err == nil {
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+		req.Header.Set("Accept", "application/json")
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		resp, err = l.client.Do(req)
+	}
+	return
+}
+
+func unexpectedStatus(resp *http.Response) error {
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("unexpected lease response status %d: %s", resp.StatusCode, msg)
+}
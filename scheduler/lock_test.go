@@ -0,0 +1,247 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const pathLeases = "/apis/coordination.k8s.io/v1/namespaces/ns0/leases"
+
+// leaseServer is the fake Kubernetes API serving the leases with the resource version preconditions.
+type leaseServer struct {
+	lock    sync.Mutex
+	leases  map[string]lease
+	version int
+}
+
+func (s *leaseServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if r.Header.Get("Authorization") != "Bearer token0" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	name := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, pathLeases), "/")
+	var in lease
+	if r.Method != http.MethodGet {
+		_ = json.NewDecoder(r.Body).Decode(&in)
+	}
+	prev, found := s.leases[name]
+	switch {
+	case r.Method == http.MethodGet && found:
+		_ = json.NewEncoder(w).Encode(prev)
+		return
+	case r.Method == http.MethodGet:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	case r.Method == http.MethodPost && s.leases[in.Metadata.Name].Metadata.Name != "":
+		w.WriteHeader(http.StatusConflict)
+		return
+	case r.Method == http.MethodPut && (!found || prev.Metadata.ResourceVersion != in.Metadata.ResourceVersion):
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	s.version++
+	in.Metadata.ResourceVersion = strconv.Itoa(s.version)
+	s.leases[in.Metadata.Name] = in
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(in)
+}
+
+func newLeaseServer(t *testing.T) (srv *httptest.Server, tokenPath string) {
+	srv = httptest.NewServer(&leaseServer{
+		leases: make(map[string]lease),
+	})
+	t.Cleanup(srv.Close)
+	tokenPath = filepath.Join(t.TempDir(), "token")
+	assert.Nil(t, os.WriteFile(tokenPath, []byte("token0\n"), 0600))
+	return
+}
+
+func TestLockLease(t *testing.T) {
+	srv, tokenPath := newLeaseServer(t)
+	l0 := NewLockLease(srv.Client(), srv.URL, tokenPath, "ns0", "holder0")
+	l1 := NewLockLease(srv.Client(), srv.URL, tokenPath, "ns0", "holder1")
+	ctx := context.TODO()
+	acquired, err := l0.TryAcquire(ctx, "job0", time.Minute)
+	assert.Nil(t, err)
+	assert.True(t, acquired)
+	acquired, err = l1.TryAcquire(ctx, "job0", time.Minute)
+	assert.Nil(t, err)
+	assert.False(t, acquired)
+	assert.NotNil(t, l1.Release(ctx, "job0"))
+	assert.Nil(t, l0.Release(ctx, "job0"))
+	// released
+	acquired, err = l1.TryAcquire(ctx, "job0", time.Millisecond)
+	assert.Nil(t, err)
+	assert.True(t, acquired)
+	// not expired yet, the lease duration is 1 second at least
+	acquired, err = l0.TryAcquire(ctx, "job0", time.Minute)
+	assert.Nil(t, err)
+	assert.False(t, acquired)
+	// another job
+	acquired, err = l0.TryAcquire(ctx, "job1", time.Minute)
+	assert.Nil(t, err)
+	assert.True(t, acquired)
+}
+
+func TestLockLease_Concurrent(t *testing.T) {
+	srv, tokenPath := newLeaseServer(t)
+	var wg sync.WaitGroup
+	var count int
+	var lock sync.Mutex
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l := NewLockLease(srv.Client(), srv.URL, tokenPath, "ns0", "holder"+strconv.Itoa(i))
+			acquired, err := l.TryAcquire(context.TODO(), "job0", time.Minute)
+			assert.Nil(t, err)
+			if acquired {
+				lock.Lock()
+				count++
+				lock.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, count)
+}
+
+func TestLockLease_Expired(t *testing.T) {
+	srv, tokenPath := newLeaseServer(t)
+	l0 := NewLockLease(srv.Client(), srv.URL, tokenPath, "ns0", "holder0")
+	l1 := NewLockLease(srv.Client(), srv.URL, tokenPath, "ns0", "holder1")
+	ctx := context.TODO()
+	acquired, err := l0.TryAcquire(ctx, "job0", time.Millisecond)
+	assert.Nil(t, err)
+	assert.True(t, acquired)
+	time.Sleep(1100 * time.Millisecond)
+	// abandoned by holder0
+	acquired, err = l1.TryAcquire(ctx, "job0", time.Minute)
+	assert.Nil(t, err)
+	assert.True(t, acquired)
+	assert.NotNil(t, l0.Release(ctx, "job0"))
+}
+
+func TestLockLease_Unauthorized(t *testing.T) {
+	srv, _ := newLeaseServer(t)
+	tokenPath := filepath.Join(t.TempDir(), "token")
+	assert.Nil(t, os.WriteFile(tokenPath, []byte("token1"), 0600))
+	l := NewLockLease(srv.Client(), srv.URL, tokenPath, "ns0", "holder0")
+	acquired, err := l.TryAcquire(context.TODO(), "job0", time.Minute)
+	assert.ErrorContains(t, err, "unexpected lease response status 401")
+	assert.False(t, acquired)
+}
+
+func TestLockLease_Renew(t *testing.T) {
+	srv, tokenPath := newLeaseServer(t)
+	l0 := NewLockLease(srv.Client(), srv.URL, tokenPath, "ns0", "holder0")
+	l1 := NewLockLease(srv.Client(), srv.URL, tokenPath, "ns0", "holder1")
+	ctx := context.TODO()
+	acquired, err := l0.TryAcquire(ctx, "job0", time.Millisecond)
+	assert.Nil(t, err)
+	assert.True(t, acquired)
+	// renewed by the same holder before it expires
+	acquired, err = l0.TryAcquire(ctx, "job0", time.Minute)
+	assert.Nil(t, err)
+	assert.True(t, acquired)
+	time.Sleep(1100 * time.Millisecond)
+	// the first lease duration passed, but the renewed one didn't
+	acquired, err = l1.TryAcquire(ctx, "job0", time.Minute)
+	assert.Nil(t, err)
+	assert.False(t, acquired)
+	assert.Nil(t, l0.Release(ctx, "job0"))
+}
+
+func TestLockLease_ExpiredConcurrent(t *testing.T) {
+	srv, tokenPath := newLeaseServer(t)
+	ctx := context.TODO()
+	acquired, err := NewLockLease(srv.Client(), srv.URL, tokenPath, "ns0", "holder").TryAcquire(ctx, "job0", time.Millisecond)
+	assert.Nil(t, err)
+	assert.True(t, acquired)
+	time.Sleep(1100 * time.Millisecond)
+	var wg sync.WaitGroup
+	var count atomic.Int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l := NewLockLease(srv.Client(), srv.URL, tokenPath, "ns0", "holder"+strconv.Itoa(i))
+			acquired, err := l.TryAcquire(ctx, "job0", time.Minute)
+			assert.Nil(t, err)
+			if acquired {
+				count.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	// only one takes over the abandoned lease
+	assert.Equal(t, int32(1), count.Load())
+}
+
+func TestLockFile(t *testing.T) {
+	dir := t.TempDir()
+	l0 := NewLockFile(dir, "holder0")
+	l1 := NewLockFile(dir, "holder1")
+	ctx := context.TODO()
+	acquired, err := l0.TryAcquire(ctx, "job0", time.Minute)
+	assert.Nil(t, err)
+	assert.True(t, acquired)
+	acquired, err = l1.TryAcquire(ctx, "job0", time.Minute)
+	assert.Nil(t, err)
+	assert.False(t, acquired)
+	assert.NotNil(t, l1.Release(ctx, "job0"))
+	assert.Nil(t, l0.Release(ctx, "job0"))
+	assert.NotNil(t, l0.Release(ctx, "job0"))
+	// released
+	acquired, err = l1.TryAcquire(ctx, "job0", time.Millisecond)
+	assert.Nil(t, err)
+	assert.True(t, acquired)
+	time.Sleep(10 * time.Millisecond)
+	// abandoned by holder1
+	acquired, err = l0.TryAcquire(ctx, "job0", time.Minute)
+	assert.Nil(t, err)
+	assert.True(t, acquired)
+	assert.NotNil(t, l1.Release(ctx, "job0"))
+	// renewed by the same holder
+	acquired, err = l0.TryAcquire(ctx, "job0", time.Minute)
+	assert.Nil(t, err)
+	assert.True(t, acquired)
+	// the incomplete file is free
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "job1.lock"), []byte("holder1\n"), 0644))
+	acquired, err = l0.TryAcquire(ctx, "job1", time.Minute)
+	assert.Nil(t, err)
+	assert.True(t, acquired)
+}
+
+func TestLockFile_Concurrent(t *testing.T) {
+	dir := t.TempDir()
+	var wg sync.WaitGroup
+	var count atomic.Int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l := NewLockFile(dir, "holder"+strconv.Itoa(i))
+			acquired, err := l.TryAcquire(context.TODO(), "job0", time.Minute)
+			assert.Nil(t, err)
+			if acquired {
+				count.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), count.Load())
+}
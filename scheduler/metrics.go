@@ -0,0 +1,38 @@
+package scheduler
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	resultOk         = "ok"
+	resultFailed     = "failed"
+	resultSkipped    = "skipped"
+	resultLockFailed = "lock_failed"
+)
+
+var counterJobRuns = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "awk_metrics_job_runs_total",
+		Help: "Scheduled job runs on this replica by the job name and the result, \"skipped\" when another replica holds the lock",
+	},
+	[]string{"job", "result"},
+)
+
+var histJobDuration = promauto.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "awk_metrics_job_duration_seconds",
+		Help:    "Scheduled job run duration by the job name and the result",
+		Buckets: []float64{1, 10, 30, 60, 120, 300, 600, 1200},
+	},
+	[]string{"job", "result"},
+)
+
+var gaugeJobLastRun = promauto.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "awk_metrics_job_last_run_timestamp_seconds",
+		Help: "Scheduled job last run start time on this replica by the job name",
+	},
+	[]string{"job"},
+)
@@ -0,0 +1,212 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/awakari/metrics/util"
+	"github.com/robfig/cron/v3"
+	"log/slog"
+	"maps"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Scheduler runs the maintenance jobs in-process by their cron schedules.
+type Scheduler interface {
+
+	// Start runs the jobs until the context is done and waits for the running jobs to finish.
+	Start(ctx context.Context)
+
+	// Status returns the status of every job.
+	Status() []JobStatus
+}
+
+// Job is the periodic maintenance task.
+type Job struct {
+	Name string
+	// Schedule is the standard 5-field cron expression, e.g. "55 23 * * *". The job is disabled when empty.
+	Schedule string
+	// Timeout limits the single run duration. Also, the lock is held for the same duration at most.
+	Timeout time.Duration
+	Run     func(ctx context.Context) (err error)
+}
+
+type JobStatus struct {
+	Name     string    `json:"name"`
+	Schedule string    `json:"schedule"`
+	Running  bool      `json:"running"`
+	Next     time.Time `json:"next"`
+	// Last is the start time of the last run on this replica
+	Last time.Time `json:"last"`
+	// LastDuration is the last run duration, in seconds
+	LastDuration float64 `json:"lastDuration,omitempty"`
+	LastError    string  `json:"lastError,omitempty"`
+	// LastSkipped is the last time the run was skipped because another replica held the lock
+	LastSkipped time.Time `json:"lastSkipped"`
+	Runs        uint64    `json:"runs"`
+	Failures    uint64    `json:"failures"`
+}
+
+type scheduler struct {
+	lock   Lock
+	log    *slog.Logger
+	cron   *cron.Cron
+	jobs   []scheduledJob
+	mu     *sync.Mutex
+	status map[string]*JobStatus
+	ids    map[string]cron.EntryID
+}
+
+type scheduledJob struct {
+	Job
+	schedule cron.Schedule
+}
+
+// releaseTimeout limits the lock release after the job run, which may be done after the job context is cancelled.
+const releaseTimeout = 10 * time.Second
+
+// ErrLockRequired means every replica would run the same jobs concurrently.
+var ErrLockRequired = errors.New("jobs lock is required when there are several replicas")
+
+// NewScheduler returns the scheduler for the enabled jobs.
+// The replicasMax is the maximum count of the replicas running the same jobs, e.g. the autoscaling limit.
+func NewScheduler(jobs []Job, lock Lock, replicasMax uint32, log *slog.Logger) (s Scheduler, err error) {
+	sched := scheduler{
+		lock:   lock,
+		log:    log,
+		cron:   cron.New(cron.WithChain(cron.SkipIfStillRunning(cron.DiscardLogger))),
+		mu:     &sync.Mutex{},
+		status: make(map[string]*JobStatus),
+		ids:    make(map[string]cron.EntryID),
+	}
+	for _, j := range jobs {
+		if j.Schedule == "" {
+			continue
+		}
+		if _, dup := sched.status[j.Name]; dup {
+			err = fmt.Errorf("duplicate job name: %s", j.Name)
+			return
+		}
+		var schedule cron.Schedule
+		schedule, err = cron.ParseStandard(j.Schedule)
+		if err != nil {
+			err = fmt.Errorf("job %s schedule %q: %w", j.Name, j.Schedule, err)
+			return
+		}
+		sched.jobs = append(sched.jobs, scheduledJob{
+			Job:      j,
+			schedule: schedule,
+		})
+		sched.status[j.Name] = &JobStatus{
+			Name:     j.Name,
+			Schedule: j.Schedule,
+		}
+	}
+	if _, none := lock.(lockNone); none && replicasMax > 1 && len(sched.jobs) > 0 {
+		err = fmt.Errorf("%w: %d replicas at most", ErrLockRequired, replicasMax)
+		return
+	}
+	s = sched
+	return
+}
+
+func (s scheduler) Start(ctx context.Context) {
+	for _, j := range s.jobs {
+		id := s.cron.Schedule(j.schedule, s.runFunc(ctx, j.Job))
+		s.mu.Lock()
+		s.ids[j.Name] = id
+		s.mu.Unlock()
+	}
+	s.cron.Start()
+	<-ctx.Done()
+	<-s.cron.Stop().Done()
+}
+
+func (s scheduler) Status() (statuses []JobStatus) {
+	s.mu.Lock()
+	for _, st := range s.status {
+		statuses = append(statuses, *st)
+	}
+	ids := maps.Clone(s.ids)
+	s.mu.Unlock()
+	for i := range statuses {
+		if id, ok := ids[statuses[i].Name]; ok {
+			statuses[i].Next = s.cron.Entry(id).Next
+		}
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+	return
+}
+
+// runFunc runs the job in the Start context, so the running job is cancelled on shutdown.
+func (s scheduler) runFunc(ctx context.Context, j Job) cron.FuncJob {
+	return func() {
+		s.run(ctx, j)
+	}
+}
+
+func (s scheduler) run(ctx context.Context, j Job) {
+	// every run is the separate request, to correlate its logs and the outgoing calls
+	ctx = util.WithRequestId(ctx, util.NewRequestId())
+	acquired, err := s.lock.TryAcquire(ctx, j.Name, j.Timeout)
+	switch {
+	case err != nil:
+		s.log.ErrorContext(ctx, "scheduler: job failed to acquire the lock", "job", j.Name, "err", err)
+		counterJobRuns.WithLabelValues(j.Name, resultLockFailed).Inc()
+		s.update(j.Name, func(st *JobStatus) {
+			st.LastError = fmt.Sprintf("failed to acquire the lock: %s", err)
+			st.Failures++
+		})
+		return
+	case !acquired:
+		s.log.DebugContext(ctx, "scheduler: job is locked by another replica, skipping", "job", j.Name)
+		counterJobRuns.WithLabelValues(j.Name, resultSkipped).Inc()
+		s.update(j.Name, func(st *JobStatus) {
+			st.LastSkipped = time.Now().UTC()
+		})
+		return
+	}
+	defer func() {
+		ctxRelease, cancelRelease := context.WithTimeout(context.WithoutCancel(ctx), releaseTimeout)
+		defer cancelRelease()
+		if errRelease := s.lock.Release(ctxRelease, j.Name); errRelease != nil {
+			s.log.WarnContext(ctx, "scheduler: job failed to release the lock", "job", j.Name, "err", errRelease)
+		}
+	}()
+	start := time.Now().UTC()
+	s.update(j.Name, func(st *JobStatus) {
+		st.Running = true
+		st.Last = start
+	})
+	ctxRun, cancel := context.WithTimeout(ctx, j.Timeout)
+	defer cancel()
+	err = j.Run(ctxRun)
+	s.log.Log(ctx, util.LogLevel(err), "scheduler: job finished", "job", j.Name, "duration", time.Since(start), "err", err)
+	result := resultOk
+	if err != nil {
+		result = resultFailed
+	}
+	counterJobRuns.WithLabelValues(j.Name, result).Inc()
+	histJobDuration.WithLabelValues(j.Name, result).Observe(time.Since(start).Seconds())
+	gaugeJobLastRun.WithLabelValues(j.Name).Set(float64(start.Unix()))
+	s.update(j.Name, func(st *JobStatus) {
+		st.Running = false
+		st.LastDuration = time.Since(start).Seconds()
+		st.LastError = ""
+		st.Runs++
+		if err != nil {
+			st.LastError = err.Error()
+			st.Failures++
+		}
+	})
+}
+
+func (s scheduler) update(name string, f func(st *JobStatus)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f(s.status[name])
+}
@@ -0,0 +1,123 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"github.com/awakari/metrics/util"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestScheduler_Run(t *testing.T) {
+	srv, tokenPath := newLeaseServer(t)
+	errFail := errors.New("fail")
+	jobs := []Job{
+		{
+			Name:     "job0",
+			Schedule: "* * * * *",
+			Timeout:  time.Minute,
+			Run: func(ctx context.Context) (err error) {
+				assert.NotEmpty(t, util.RequestId(ctx))
+				return
+			},
+		},
+		{
+			Name:     "job1",
+			Schedule: "@hourly",
+			Timeout:  time.Minute,
+			Run: func(ctx context.Context) (err error) {
+				err = errFail
+				return
+			},
+		},
+		{
+			Name: "disabled",
+			Run: func(ctx context.Context) (err error) {
+				panic("should not run")
+			},
+		},
+	}
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s, err := NewScheduler(jobs, NewLockLease(srv.Client(), srv.URL, tokenPath, "ns0", "holder0"), 3, log)
+	assert.Nil(t, err)
+	sched := s.(scheduler)
+	ctx := context.TODO()
+	sched.run(ctx, jobs[0])
+	sched.run(ctx, jobs[1])
+	// another replica holds the lock
+	acquired, err := NewLockLease(srv.Client(), srv.URL, tokenPath, "ns0", "holder1").TryAcquire(ctx, "job0", time.Minute)
+	assert.Nil(t, err)
+	assert.True(t, acquired)
+	sched.run(ctx, jobs[0])
+	statuses := s.Status()
+	assert.Equal(t, 2, len(statuses))
+	assert.Equal(t, "job0", statuses[0].Name)
+	assert.Equal(t, uint64(1), statuses[0].Runs)
+	assert.Equal(t, uint64(0), statuses[0].Failures)
+	assert.False(t, statuses[0].LastSkipped.IsZero())
+	assert.Equal(t, "job1", statuses[1].Name)
+	assert.Equal(t, uint64(1), statuses[1].Failures)
+	assert.Equal(t, "fail", statuses[1].LastError)
+}
+
+func TestNewScheduler_InvalidSchedule(t *testing.T) {
+	_, err := NewScheduler([]Job{{Name: "job0", Schedule: "every minute"}}, NewLockNone(), 1, slog.Default())
+	assert.NotNil(t, err)
+}
+
+func TestNewScheduler_LockRequired(t *testing.T) {
+	jobs := []Job{
+		{
+			Name:     "job0",
+			Schedule: "@hourly",
+		},
+	}
+	_, err := NewScheduler(jobs, NewLockNone(), 1, slog.Default())
+	assert.Nil(t, err)
+	_, err = NewScheduler(jobs, NewLockNone(), 2, slog.Default())
+	assert.ErrorIs(t, err, ErrLockRequired)
+	// no enabled jobs
+	_, err = NewScheduler([]Job{{Name: "job0"}}, NewLockNone(), 2, slog.Default())
+	assert.Nil(t, err)
+}
+
+func TestScheduler_Start(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	started := make(chan struct{})
+	jobs := []Job{
+		{
+			Name:     "job0",
+			Schedule: "@every 10ms",
+			Timeout:  time.Minute,
+			Run: func(ctx context.Context) (err error) {
+				select {
+				case started <- struct{}{}:
+				default:
+				}
+				// cancelled with the Start context
+				<-ctx.Done()
+				return ctx.Err()
+			},
+		},
+	}
+	s, err := NewScheduler(jobs, NewLockNone(), 1, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	assert.Nil(t, err)
+	stopped := make(chan struct{})
+	go func() {
+		s.Start(ctx)
+		close(stopped)
+	}()
+	<-started
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("running job is not cancelled on stop")
+	}
+	statuses := s.Status()
+	assert.Equal(t, 1, len(statuses))
+	assert.Equal(t, "context canceled", statuses[0].LastError)
+}
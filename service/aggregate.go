@@ -0,0 +1,189 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/awakari/metrics/promql"
+	"slices"
+	"sync"
+	"time"
+)
+
+var attrNamesBlackList = map[string]bool{
+	"awakariuserid": true,
+	"awkinternal":   true,
+	"evtid":         true,
+	"evtlink":       true,
+	"reason":        true,
+}
+var attrNamesBuiltIn = map[string][]string{
+	"": {
+		"boolean",
+		"bytes",
+		"int32",
+		"string",
+		"uri",
+		"uriref",
+		"timestamp",
+	},
+	"data": {
+		"bytes",
+		"string",
+	},
+	"latitude": {
+		"int32",
+	},
+	"longitude": {
+		"int32",
+	},
+	"source": {
+		"string",
+	},
+	"type": {
+		"string",
+	},
+}
+
+// PublicAttributeTypes removes the internal attributes and adds the built-in ones.
+func PublicAttributeTypes(attrs Attributes) Attributes {
+	if attrs.TypesByKey == nil {
+		attrs.TypesByKey = make(map[string][]string)
+	}
+	for k, _ := range attrNamesBlackList {
+		delete(attrs.TypesByKey, k)
+	}
+	for k, typ := range attrNamesBuiltIn {
+		attrs.TypesByKey[k] = typ
+	}
+	return attrs
+}
+
+// GetReadStatus returns the total read rate and the page of the most read sources with their shares in it.
+// The offset and limit select the page in the sources sorted by the read rate descending.
+// All the sources are returned when the limit is zero.
+func GetReadStatus(ctx context.Context, svc Service, metricReadCount, metricSourcesReadCount, period string, offset, limit uint32) (s ReadStatus, warns Warnings, err error) {
+	s.SourcesMostRead = make(map[string]float64)
+	s.Sources = []SourceShare{}
+	s.ReadRate, warns, err = svc.GetRateAverage(ctx, metricReadCount, "service", period)
+	if err == nil && limit == 0 {
+		var w Warnings
+		var srcs map[string]float64
+		srcs, w, err = svc.GetRelativeRateByLabel(ctx, s.ReadRate, metricSourcesReadCount, "source", period)
+		warns = append(warns, w...)
+		for src, share := range srcs {
+			s.SourcesMostRead[src] = share
+			s.Sources = append(s.Sources, SourceShare{
+				Source: src,
+				Share:  share,
+			})
+		}
+		slices.SortFunc(s.Sources, func(a, b SourceShare) int {
+			return cmp.Or(cmp.Compare(b.Share, a.Share), cmp.Compare(a.Source, b.Source))
+		})
+		return
+	}
+	var w Warnings
+	var top []LabelRate
+	if err == nil && s.ReadRate > 0 {
+		// offset and limit are bounded by the callers, the sum doesn't overflow
+		top, w, err = svc.GetTopRatesByLabel(ctx, metricSourcesReadCount, "source", period, offset+limit)
+		warns = append(warns, w...)
+	}
+	var shareTop float64
+	for i, r := range top {
+		share := r.Rate / s.ReadRate
+		shareTop += share
+		if uint32(i) >= offset {
+			s.Sources = append(s.Sources, SourceShare{
+				Source: r.Label,
+				Share:  share,
+			})
+			s.SourcesMostRead[r.Label] = share
+		}
+	}
+	if s.ReadRate > 0 && uint32(len(top)) == offset+limit {
+		// the rest of the sources beyond the page
+		s.Other = max(0, 1-shareTop)
+	}
+	return
+}
+
+const fmtQuerySourceRate = "sum(rate(%s{%s}[%s]))"
+const fmtQuerySourcesReadBefore = "count(sum by (source) (rate(%s[%s])) > %g)"
+
+// GetSourceStats returns the publish and read rates of the single source and its position among the read sources.
+// Missing data means zero rate.
+func GetSourceStats(ctx context.Context, svc Service, metricPublished, metricReadCount, metricSourcesReadCount, src, period string) (s SourceStats, warns Warnings, err error) {
+	var matcher string
+	matcher, err = promql.LabelMatcher("source", src)
+	var w Warnings
+	if err == nil {
+		s.PublishRate, warns, err = svc.GetValue(ctx, fmt.Sprintf(fmtQuerySourceRate, metricPublished, matcher, period))
+		err = ignoreEmptyResult(err)
+	}
+	if err == nil {
+		s.ReadRate, w, err = svc.GetValue(ctx, fmt.Sprintf(fmtQuerySourceRate, metricSourcesReadCount, matcher, period))
+		warns = append(warns, w...)
+		err = ignoreEmptyResult(err)
+	}
+	if err == nil && s.ReadRate > 0 {
+		var readRateTotal float64
+		readRateTotal, w, err = svc.GetRateAverage(ctx, metricReadCount, "service", period)
+		warns = append(warns, w...)
+		if err == nil && readRateTotal > 0 {
+			s.ReadShare = s.ReadRate / readRateTotal
+		}
+		err = ignoreEmptyResult(err)
+	}
+	if err == nil && s.ReadRate > 0 {
+		var readBefore float64
+		readBefore, w, err = svc.GetValue(ctx, fmt.Sprintf(fmtQuerySourcesReadBefore, metricSourcesReadCount, period, s.ReadRate))
+		warns = append(warns, w...)
+		err = ignoreEmptyResult(err)
+		s.Rank = int(readBefore) + 1
+	}
+	return
+}
+
+func ignoreEmptyResult(src error) (dst error) {
+	if !errors.Is(src, ErrEmptyResult) {
+		dst = src
+	}
+	return
+}
+
+// GetDurationQuantiles queries the 0.5, 0.75, 0.95 and 0.99 quantiles in parallel.
+// The quantile is left zero when there's no data for it.
+func GetDurationQuantiles(ctx context.Context, svc Service, metricName string, t time.Duration) (dur Duration, warns Warnings, errs error) {
+
+	wg := sync.WaitGroup{}
+	lock := sync.Mutex{}
+
+	for _, q := range []struct {
+		quantile float64
+		dst      *float64
+	}{
+		{0.5, &dur.Quantile05},
+		{0.75, &dur.Quantile075},
+		{0.95, &dur.Quantile095},
+		{0.99, &dur.Quantile099},
+	} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d, w, err := svc.GetDuration(ctx, metricName, q.quantile, t)
+			lock.Lock()
+			defer lock.Unlock()
+			*q.dst = d
+			warns = append(warns, w...)
+			if err != nil && !errors.Is(err, ErrEmptyResult) {
+				errs = errors.Join(errs, err)
+			}
+		}()
+	}
+
+	wg.Wait()
+	return
+}
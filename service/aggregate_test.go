@@ -0,0 +1,156 @@
+package service
+
+import (
+	"context"
+	"github.com/awakari/metrics/promql"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type svcValuesMock struct {
+	Service
+	values map[string]float64
+}
+
+func (s svcValuesMock) GetValue(ctx context.Context, query string) (val float64, warns Warnings, err error) {
+	val, ok := s.values[query]
+	if !ok {
+		err = ErrEmptyResult
+	}
+	return
+}
+
+func (s svcValuesMock) GetRateAverage(ctx context.Context, metricName string, sumBy string, period string) (rate float64, warns Warnings, err error) {
+	rate, warns, err = s.GetValue(ctx, metricName)
+	return
+}
+
+func TestGetSourceStats(t *testing.T) {
+	svc := svcValuesMock{
+		values: map[string]float64{
+			`sum(rate(published{source="https://example.com/feed.xml"}[1d]))`: 0.1,
+			`sum(rate(src_read{source="https://example.com/feed.xml"}[1d]))`:  0.5,
+			"read": 2,
+			`count(sum by (source) (rate(src_read[1d])) > 0.5)`: 3,
+		},
+	}
+	cases := map[string]struct {
+		src   string
+		stats SourceStats
+		err   error
+	}{
+		"https://example.com/feed.xml": {
+			stats: SourceStats{
+				PublishRate: 0.1,
+				ReadRate:    0.5,
+				ReadShare:   0.25,
+				Rank:        4,
+			},
+		},
+		"https://example.com/unknown.xml": {},
+		`https://example.com/"}`: {
+			err: promql.ErrInvalid,
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			stats, _, err := GetSourceStats(context.TODO(), svc, "published", "read", "src_read", k, "1d")
+			assert.Equal(t, c.stats, stats)
+			assert.ErrorIs(t, err, c.err)
+		})
+	}
+}
+
+type svcTopMock struct {
+	Service
+	readRate float64
+	top      []LabelRate
+}
+
+func (s svcTopMock) GetRateAverage(ctx context.Context, metricName string, sumBy string, period string) (rate float64, warns Warnings, err error) {
+	rate = s.readRate
+	return
+}
+
+func (s svcTopMock) GetRelativeRateByLabel(ctx context.Context, rateSum float64, metricName string, key string, period string) (rateByKey map[string]float64, warns Warnings, err error) {
+	rateByKey = make(map[string]float64)
+	for _, r := range s.top {
+		rateByKey[r.Label] = r.Rate / rateSum
+	}
+	return
+}
+
+func (s svcTopMock) GetTopRatesByLabel(ctx context.Context, metricName string, key string, period string, count uint32) (rates []LabelRate, warns Warnings, err error) {
+	rates = s.top[:min(int(count), len(s.top))]
+	return
+}
+
+func TestGetReadStatus(t *testing.T) {
+	svc := svcTopMock{
+		readRate: 10,
+		top: []LabelRate{
+			{"src0", 4},
+			{"src1", 3},
+			{"src2", 2},
+			{"src3", 1},
+		},
+	}
+	cases := map[string]struct {
+		offset  uint32
+		limit   uint32
+		sources []SourceShare
+		other   float64
+	}{
+		"first page": {
+			limit: 2,
+			sources: []SourceShare{
+				{"src0", 0.4},
+				{"src1", 0.3},
+			},
+			other: 0.3,
+		},
+		"second page": {
+			offset: 2,
+			limit:  1,
+			sources: []SourceShare{
+				{"src2", 0.2},
+			},
+			other: 0.1,
+		},
+		"last page": {
+			offset: 2,
+			limit:  10,
+			sources: []SourceShare{
+				{"src2", 0.2},
+				{"src3", 0.1},
+			},
+		},
+		"beyond": {
+			offset:  10,
+			limit:   10,
+			sources: []SourceShare{},
+		},
+		"all": {
+			sources: []SourceShare{
+				{"src0", 0.4},
+				{"src1", 0.3},
+				{"src2", 0.2},
+				{"src3", 0.1},
+			},
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			s, _, err := GetReadStatus(context.TODO(), svc, "read", "src_read", "1d", c.offset, c.limit)
+			assert.Nil(t, err)
+			assert.Equal(t, float64(10), s.ReadRate)
+			assert.Equal(t, len(c.sources), len(s.Sources))
+			for i, src := range c.sources {
+				assert.Equal(t, src.Source, s.Sources[i].Source)
+				assert.InDelta(t, src.Share, s.Sources[i].Share, 1e-9)
+				assert.InDelta(t, src.Share, s.SourcesMostRead[src.Source], 1e-9)
+			}
+			assert.InDelta(t, c.other, s.Other, 1e-9)
+		})
+	}
+}
@@ -0,0 +1,269 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/common/model"
+	"golang.org/x/sync/singleflight"
+	"maps"
+	"regexp"
+	"slices"
+	"sync"
+	"time"
+)
+
+type cache struct {
+	svc      Service
+	capacity int
+	ttlMin   time.Duration
+	ttlMax   time.Duration
+	timeout  time.Duration
+	group    *singleflight.Group
+	lock     *sync.Mutex
+	entries  map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	result  any
+	warns   Warnings
+	expires time.Time
+}
+
+var rangeSelector = regexp.MustCompile(`\[(\w+)]`)
+
+// cacheTtlPeriodRatio defines the cached result lifetime relative to the query period:
+// the result of the rate over the last hour may be reused for 6 minutes.
+const cacheTtlPeriodRatio = 10
+
+var cacheHits = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "awk_metrics_cache_hit_count",
+		Help: "Metrics query results served from the cache",
+	},
+	[]string{"method"},
+)
+var cacheMisses = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "awk_metrics_cache_miss_count",
+		Help: "Metrics query results missing in the cache",
+	},
+	[]string{"method"},
+)
+
+// NewCache returns the Service that caches the successful results of the underlying one.
+// Concurrent identical queries are deduplicated, so only one of them reaches Prometheus.
+// The result lifetime is derived from the query period and bounded by the ttlMin and ttlMax.
+// The shared query isn't bound to any of the callers, so it's limited by the timeout instead,
+// while every caller stops waiting for it when its own context is done.
+func NewCache(svc Service, capacity uint32, ttlMin, ttlMax, timeout time.Duration) Service {
+	return cache{
+		svc:      svc,
+		capacity: int(capacity),
+		ttlMin:   ttlMin,
+		ttlMax:   ttlMax,
+		timeout:  timeout,
+		group:    &singleflight.Group{},
+		lock:     &sync.Mutex{},
+		entries:  make(map[string]cacheEntry),
+	}
+}
+
+func (c cache) GetRateAverage(ctx context.Context, metricName string, sumBy string, period string) (rate float64, warns Warnings, err error) {
+	k := fmt.Sprintf("GetRateAverage(%s, %s, %s)", metricName, sumBy, period)
+	rate, warns, err = cached(ctx, c, "GetRateAverage", k, c.ttlOfPeriod(period), func(ctx context.Context) (float64, Warnings, error) {
+		return c.svc.GetRateAverage(ctx, metricName, sumBy, period)
+	})
+	return
+}
+
+func (c cache) GetNumberHistory(ctx context.Context, metricName string) (nh NumberHistory, warns Warnings, errs error) {
+	k := fmt.Sprintf("GetNumberHistory(%s)", metricName)
+	nh, warns, errs = cached(ctx, c, "GetNumberHistory", k, c.ttlMax, func(ctx context.Context) (NumberHistory, Warnings, error) {
+		return c.svc.GetNumberHistory(ctx, metricName)
+	})
+	return
+}
+
+func (c cache) GetRelativeRateByLabel(ctx context.Context, rateSum float64, metricName string, key string, period string) (rateByKey map[string]float64, warns Warnings, errs error) {
+	k := fmt.Sprintf("GetRelativeRateByLabel(%v, %s, %s, %s)", rateSum, metricName, key, period)
+	rateByKey, warns, errs = cached(ctx, c, "GetRelativeRateByLabel", k, c.ttlOfPeriod(period), func(ctx context.Context) (map[string]float64, Warnings, error) {
+		return c.svc.GetRelativeRateByLabel(ctx, rateSum, metricName, key, period)
+	})
+	rateByKey = maps.Clone(rateByKey)
+	return
+}
+
+func (c cache) GetTopRatesByLabel(ctx context.Context, metricName string, key string, period string, count uint32) (rates []LabelRate, warns Warnings, err error) {
+	k := fmt.Sprintf("GetTopRatesByLabel(%s, %s, %s, %d)", metricName, key, period, count)
+	rates, warns, err = cached(ctx, c, "GetTopRatesByLabel", k, c.ttlOfPeriod(period), func(ctx context.Context) ([]LabelRate, Warnings, error) {
+		return c.svc.GetTopRatesByLabel(ctx, metricName, key, period, count)
+	})
+	rates = slices.Clone(rates)
+	return
+}
+
+func (c cache) GetEventAttributeTypes(ctx context.Context, metric, sumBy, period string) (attrs Attributes, warns Warnings, err error) {
+	k := fmt.Sprintf("GetEventAttributeTypes(%s, %s, %s)", metric, sumBy, period)
+	attrs, warns, err = cached(ctx, c, "GetEventAttributeTypes", k, c.ttlOfPeriod(period), func(ctx context.Context) (Attributes, Warnings, error) {
+		return c.svc.GetEventAttributeTypes(ctx, metric, sumBy, period)
+	})
+	attrs.TypesByKey = maps.Clone(attrs.TypesByKey)
+	return
+}
+
+func (c cache) GetEventAttributeValuesByName(ctx context.Context, metric, name string) (vals []string, warns Warnings, err error) {
+	k := fmt.Sprintf("GetEventAttributeValuesByName(%s, %s)", metric, name)
+	vals, warns, err = cached(ctx, c, "GetEventAttributeValuesByName", k, c.ttlMax, func(ctx context.Context) ([]string, Warnings, error) {
+		return c.svc.GetEventAttributeValuesByName(ctx, metric, name)
+	})
+	vals = slices.Clone(vals)
+	return
+}
+
+func (c cache) GetDuration(ctx context.Context, metricName string, quantile float64, t time.Duration) (dSeconds float64, warns Warnings, errs error) {
+	k := fmt.Sprintf("GetDuration(%s, %f, %s)", metricName, quantile, t)
+	dSeconds, warns, errs = cached(ctx, c, "GetDuration", k, c.ttlOf(t), func(ctx context.Context) (float64, Warnings, error) {
+		return c.svc.GetDuration(ctx, metricName, quantile, t)
+	})
+	return
+}
+
+func (c cache) GetSeries(ctx context.Context, metricName string, start, end time.Time, step time.Duration) (series []Point, warns Warnings, err error) {
+	k := fmt.Sprintf("GetSeries(%s, %d, %d, %s)", metricName, start.Unix(), end.Unix(), step)
+	series, warns, err = cached(ctx, c, "GetSeries", k, c.ttlOf(step), func(ctx context.Context) ([]Point, Warnings, error) {
+		return c.svc.GetSeries(ctx, metricName, start, end, step)
+	})
+	series = slices.Clone(series)
+	return
+}
+
+func (c cache) GetValue(ctx context.Context, query string) (val float64, warns Warnings, err error) {
+	k := fmt.Sprintf("GetValue(%s)", query)
+	val, warns, err = cached(ctx, c, "GetValue", k, c.ttlOfQuery(query), func(ctx context.Context) (float64, Warnings, error) {
+		return c.svc.GetValue(ctx, query)
+	})
+	return
+}
+
+func (c cache) GetVector(ctx context.Context, query string) (vec []Sample, warns Warnings, err error) {
+	k := fmt.Sprintf("GetVector(%s)", query)
+	vec, warns, err = cached(ctx, c, "GetVector", k, c.ttlOfQuery(query), func(ctx context.Context) ([]Sample, Warnings, error) {
+		return c.svc.GetVector(ctx, query)
+	})
+	vec = slices.Clone(vec)
+	return
+}
+
+// ttlOfQuery derives the lifetime from the longest range selector in the query, e.g. "[1h]".
+func (c cache) ttlOfQuery(q string) (ttl time.Duration) {
+	var period time.Duration
+	for _, m := range rangeSelector.FindAllStringSubmatch(q, -1) {
+		d, err := model.ParseDuration(m[1])
+		if err == nil && time.Duration(d) > period {
+			period = time.Duration(d)
+		}
+	}
+	ttl = c.ttlOf(period)
+	return
+}
+
+func (c cache) ttlOfPeriod(period string) (ttl time.Duration) {
+	d, err := model.ParseDuration(period)
+	switch err {
+	case nil:
+		ttl = c.ttlOf(time.Duration(d))
+	default:
+		ttl = c.ttlMin
+	}
+	return
+}
+
+func (c cache) ttlOf(period time.Duration) (ttl time.Duration) {
+	ttl = period / cacheTtlPeriodRatio
+	switch {
+	case ttl < c.ttlMin:
+		ttl = c.ttlMin
+	case ttl > c.ttlMax:
+		ttl = c.ttlMax
+	}
+	return
+}
+
+func (c cache) get(k string) (e cacheEntry, ok bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	e, ok = c.entries[k]
+	if ok && !e.expires.After(time.Now()) {
+		delete(c.entries, k)
+		ok = false
+	}
+	return
+}
+
+func (c cache) put(k string, e cacheEntry) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if len(c.entries) >= c.capacity {
+		now := time.Now()
+		for k1, e1 := range c.entries {
+			if !e1.expires.After(now) {
+				delete(c.entries, k1)
+			}
+		}
+	}
+	if len(c.entries) >= c.capacity {
+		// evict the entry expiring first, it's the oldest one among the same ttl ones
+		var kEvict string
+		var expiresEvict time.Time
+		for k1, e1 := range c.entries {
+			if kEvict == "" || e1.expires.Before(expiresEvict) {
+				kEvict = k1
+				expiresEvict = e1.expires
+			}
+		}
+		delete(c.entries, kEvict)
+	}
+	if c.capacity > 0 {
+		c.entries[k] = e
+	}
+}
+
+func cached[T any](ctx context.Context, c cache, method, k string, ttl time.Duration, load func(ctx context.Context) (T, Warnings, error)) (result T, warns Warnings, err error) {
+	e, ok := c.get(k)
+	switch ok {
+	case true:
+		cacheHits.WithLabelValues(method).Inc()
+	default:
+		cacheMisses.WithLabelValues(method).Inc()
+		// the first caller leaving shouldn't fail the others waiting for the same result
+		ctxLoad := context.WithoutCancel(ctx)
+		ch := c.group.DoChan(k, func() (v any, err error) {
+			ctxLoad, cancel := context.WithTimeout(ctxLoad, c.timeout)
+			defer cancel()
+			var r T
+			var w Warnings
+			r, w, err = load(ctxLoad)
+			v = cacheEntry{
+				result:  r,
+				warns:   w,
+				expires: time.Now().Add(ttl),
+			}
+			if err == nil {
+				c.put(k, v.(cacheEntry))
+			}
+			return
+		})
+		select {
+		case res := <-ch:
+			e, err = res.Val.(cacheEntry), res.Err
+		case <-ctx.Done():
+			err = decodeError(ctx.Err())
+			return
+		}
+	}
+	result = e.result.(T)
+	warns = slices.Clone(e.warns)
+	return
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"maps"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type serviceCounting struct {
+	Service
+	count *atomic.Int64
+	delay time.Duration
+	err   error
+}
+
+func (sc serviceCounting) GetRateAverage(ctx context.Context, metricName string, sumBy string, period string) (rate float64, warns Warnings, err error) {
+	sc.count.Add(1)
+	time.Sleep(sc.delay)
+	return 42, Warnings{"warn0"}, sc.err
+}
+
+func TestCache_GetRateAverage(t *testing.T) {
+	svc := serviceCounting{
+		count: &atomic.Int64{},
+		delay: 100 * time.Millisecond,
+	}
+	c := NewCache(svc, 10, time.Minute, time.Hour, time.Minute)
+	wg := sync.WaitGroup{}
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rate, warns, err := c.GetRateAverage(context.TODO(), "metric0", "service", "1h")
+			assert.Nil(t, err)
+			assert.Equal(t, 42.0, rate)
+			assert.Equal(t, Warnings{"warn0"}, warns)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int64(1), svc.count.Load())
+	_, _, _ = c.GetRateAverage(context.TODO(), "metric0", "service", "1h")
+	assert.Equal(t, int64(1), svc.count.Load())
+	_, _, _ = c.GetRateAverage(context.TODO(), "metric0", "service", "1d")
+	assert.Equal(t, int64(2), svc.count.Load())
+}
+
+func TestCache_GetRateAverageErrNotCached(t *testing.T) {
+	svc := serviceCounting{
+		count: &atomic.Int64{},
+		err:   ErrUnavailable,
+	}
+	c := NewCache(svc, 10, time.Minute, time.Hour, time.Minute)
+	_, _, err := c.GetRateAverage(context.TODO(), "metric0", "service", "1h")
+	assert.ErrorIs(t, err, ErrUnavailable)
+	_, _, err = c.GetRateAverage(context.TODO(), "metric0", "service", "1h")
+	assert.ErrorIs(t, err, ErrUnavailable)
+	assert.Equal(t, int64(2), svc.count.Load())
+}
+
+type serviceWaiting struct {
+	Service
+	count *atomic.Int64
+	delay time.Duration
+}
+
+func (sw serviceWaiting) GetRateAverage(ctx context.Context, metricName string, sumBy string, period string) (rate float64, warns Warnings, err error) {
+	sw.count.Add(1)
+	select {
+	case <-time.After(sw.delay):
+		rate = 42
+	case <-ctx.Done():
+		err = decodeError(ctx.Err())
+	}
+	return
+}
+
+func TestCache_GetRateAverageCallerCanceled(t *testing.T) {
+	svc := serviceWaiting{
+		count: &atomic.Int64{},
+		delay: 100 * time.Millisecond,
+	}
+	c := NewCache(svc, 10, time.Minute, time.Hour, time.Minute)
+	ctxFirst, cancel := context.WithCancel(context.TODO())
+	errFirst := make(chan error)
+	go func() {
+		_, _, err := c.GetRateAverage(ctxFirst, "metric0", "service", "1h")
+		errFirst <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	rate, _, err := c.GetRateAverage(context.TODO(), "metric0", "service", "1h")
+	assert.Nil(t, err)
+	assert.Equal(t, 42.0, rate)
+	assert.ErrorIs(t, <-errFirst, ErrCanceled)
+	// cached despite the first caller has gone
+	rate, _, err = c.GetRateAverage(context.TODO(), "metric0", "service", "1h")
+	assert.Nil(t, err)
+	assert.Equal(t, 42.0, rate)
+	assert.Equal(t, int64(1), svc.count.Load())
+}
+
+func TestCache_Put(t *testing.T) {
+	c := NewCache(nil, 2, time.Minute, time.Hour, time.Minute).(cache)
+	now := time.Now()
+	c.put("expired", cacheEntry{expires: now.Add(-time.Second)})
+	c.put("hot", cacheEntry{expires: now.Add(time.Hour)})
+	c.put("k0", cacheEntry{expires: now.Add(time.Minute)})
+	assert.ElementsMatch(t, []string{"hot", "k0"}, slices.Collect(maps.Keys(c.entries)))
+	c.put("k1", cacheEntry{expires: now.Add(time.Hour)})
+	assert.ElementsMatch(t, []string{"hot", "k1"}, slices.Collect(maps.Keys(c.entries)))
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"time"
+)
+
+type instrumented struct {
+	svc Service
+}
+
+var histQueryDuration = promauto.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "awk_metrics_prometheus_query_duration_seconds",
+		Help:    "Prometheus query duration by the logical query, the metric and the result",
+		Buckets: prometheus.DefBuckets,
+	},
+	[]string{"query", "metric", "result"},
+)
+
+// NewInstrumented returns the Service observing the Prometheus queries duration and results.
+// The metric label is empty for the raw queries to keep the cardinality bounded.
+// Wrap it with the cache, so the cache hits are not observed.
+func NewInstrumented(svc Service) Service {
+	return instrumented{
+		svc: svc,
+	}
+}
+
+func observe(query, metric string, start time.Time, err error) {
+	histQueryDuration.WithLabelValues(query, metric, result(err)).Observe(time.Since(start).Seconds())
+}
+
+func result(err error) (r string) {
+	switch {
+	case err == nil:
+		r = "ok"
+	case errors.Is(err, ErrEmptyResult):
+		r = "empty"
+	case errors.Is(err, ErrBadQuery):
+		r = "bad_query"
+	case errors.Is(err, ErrTimeout):
+		r = "timeout"
+	case errors.Is(err, ErrCanceled):
+		r = "canceled"
+	case errors.Is(err, ErrUnavailable):
+		r = "unavailable"
+	default:
+		r = "error"
+	}
+	return
+}
+
+func (i instrumented) GetRateAverage(ctx context.Context, metricName string, sumBy string, period string) (rate float64, warns Warnings, err error) {
+	start := time.Now()
+	rate, warns, err = i.svc.GetRateAverage(ctx, metricName, sumBy, period)
+	observe("GetRateAverage", metricName, start, err)
+	return
+}
+
+func (i instrumented) GetNumberHistory(ctx context.Context, metricName string) (nh NumberHistory, warns Warnings, errs error) {
+	start := time.Now()
+	nh, warns, errs = i.svc.GetNumberHistory(ctx, metricName)
+	observe("GetNumberHistory", metricName, start, errs)
+	return
+}
+
+func (i instrumented) GetRelativeRateByLabel(ctx context.Context, rateSum float64, metricName string, key string, period string) (rateByKey map[string]float64, warns Warnings, errs error) {
+	start := time.Now()
+	rateByKey, warns, errs = i.svc.GetRelativeRateByLabel(ctx, rateSum, metricName, key, period)
+	observe("GetRelativeRateByLabel", metricName, start, errs)
+	return
+}
+
+func (i instrumented) GetTopRatesByLabel(ctx context.Context, metricName string, key string, period string, count uint32) (rates []LabelRate, warns Warnings, err error) {
+	start := time.Now()
+	rates, warns, err = i.svc.GetTopRatesByLabel(ctx, metricName, key, period, count)
+	observe("GetTopRatesByLabel", metricName, start, err)
+	return
+}
+
+func (i instrumented) GetEventAttributeTypes(ctx context.Context, metric, sumBy, period string) (attrs Attributes, warns Warnings, err error) {
+	start := time.Now()
+	attrs, warns, err = i.svc.GetEventAttributeTypes(ctx, metric, sumBy, period)
+	observe("GetEventAttributeTypes", metric, start, err)
+	return
+}
+
+func (i instrumented) GetEventAttributeValuesByName(ctx context.Context, metric, name string) (vals []string, warns Warnings, err error) {
+	start := time.Now()
+	vals, warns, err = i.svc.GetEventAttributeValuesByName(ctx, metric, name)
+	observe("GetEventAttributeValuesByName", metric, start, err)
+	return
+}
+
+func (i instrumented) GetDuration(ctx context.Context, metricName string, quantile float64, t time.Duration) (dSeconds float64, warns Warnings, errs error) {
+	start := time.Now()
+	dSeconds, warns, errs = i.svc.GetDuration(ctx, metricName, quantile, t)
+	observe("GetDuration", metricName, start, errs)
+	return
+}
+
+func (i instrumented) GetSeries(ctx context.Context, metricName string, start, end time.Time, step time.Duration) (series []Point, warns Warnings, err error) {
+	t := time.Now()
+	series, warns, err = i.svc.GetSeries(ctx, metricName, start, end, step)
+	// the series may be requested by the arbitrary query
+	observe("GetSeries", "", t, err)
+	return
+}
+
+func (i instrumented) GetValue(ctx context.Context, query string) (val float64, warns Warnings, err error) {
+	start := time.Now()
+	val, warns, err = i.svc.GetValue(ctx, query)
+	observe("GetValue", "", start, err)
+	return
+}
+
+func (i instrumented) GetVector(ctx context.Context, query string) (vec []Sample, warns Warnings, err error) {
+	start := time.Now()
+	vec, warns, err = i.svc.GetVector(ctx, query)
+	observe("GetVector", "", start, err)
+	return
+}
@@ -2,7 +2,6 @@ package service
 
 import (
 	"context"
-	"fmt"
 	"github.com/awakari/metrics/util"
 	"log/slog"
 	"time"
@@ -19,38 +18,72 @@ func NewLogging(svc Service, log *slog.Logger) Service {
 		log: log,
 	}
 }
-func (l logging) GetRateAverage(ctx context.Context, metricName string, sumBy string, period string) (rate float64, err error) {
-	rate, err = l.svc.GetRateAverage(ctx, metricName, sumBy, period)
-	l.log.Log(ctx, util.LogLevel(err), fmt.Sprintf("service.GetRateAverage(%s, %s, %s): %f, %s", metricName, sumBy, period, rate, err))
+func (l logging) GetRateAverage(ctx context.Context, metricName string, sumBy string, period string) (rate float64, warns Warnings, err error) {
+	start := time.Now()
+	rate, warns, err = l.svc.GetRateAverage(ctx, metricName, sumBy, period)
+	l.log.Log(ctx, util.LogLevel(err), "service.GetRateAverage", "metric", metricName, "sumBy", sumBy, "period", period, "rate", rate, "warnings", warns, "duration", time.Since(start), "err", err)
 	return
 }
 
-func (l logging) GetNumberHistory(ctx context.Context, metricName string) (nh NumberHistory, errs error) {
-	nh, errs = l.svc.GetNumberHistory(ctx, metricName)
-	l.log.Log(ctx, util.LogLevel(errs), fmt.Sprintf("service.GetNumberHistory(%s): %v, %s", metricName, nh, errs))
+func (l logging) GetNumberHistory(ctx context.Context, metricName string) (nh NumberHistory, warns Warnings, errs error) {
+	start := time.Now()
+	nh, warns, errs = l.svc.GetNumberHistory(ctx, metricName)
+	l.log.Log(ctx, util.LogLevel(errs), "service.GetNumberHistory", "metric", metricName, "history", nh, "warnings", warns, "duration", time.Since(start), "err", errs)
 	return
 }
 
-func (l logging) GetRelativeRateByLabel(ctx context.Context, rateSum float64, metricName string, key string, period string) (rateByKey map[string]float64, errs error) {
-	rateByKey, errs = l.svc.GetRelativeRateByLabel(ctx, rateSum, metricName, key, period)
-	l.log.Log(ctx, util.LogLevel(errs), fmt.Sprintf("service.GetRelativeRateByLabel(%v, %s, %s, %s): %d, %s", rateSum, metricName, key, period, len(rateByKey), errs))
+func (l logging) GetRelativeRateByLabel(ctx context.Context, rateSum float64, metricName string, key string, period string) (rateByKey map[string]float64, warns Warnings, errs error) {
+	start := time.Now()
+	rateByKey, warns, errs = l.svc.GetRelativeRateByLabel(ctx, rateSum, metricName, key, period)
+	l.log.Log(ctx, util.LogLevel(errs), "service.GetRelativeRateByLabel", "rateSum", rateSum, "metric", metricName, "key", key, "period", period, "count", len(rateByKey), "warnings", warns, "duration", time.Since(start), "err", errs)
 	return
 }
 
-func (l logging) GetEventAttributeTypes(ctx context.Context, metric, sumBy, period string) (attrs Attributes, err error) {
-	attrs, err = l.svc.GetEventAttributeTypes(ctx, metric, sumBy, period)
-	l.log.Log(ctx, util.LogLevel(err), fmt.Sprintf("service.GetEventAttributeTypes(%s, %s, %s): %v, %s", metric, sumBy, period, attrs, err))
+func (l logging) GetTopRatesByLabel(ctx context.Context, metricName string, key string, period string, count uint32) (rates []LabelRate, warns Warnings, err error) {
+	start := time.Now()
+	rates, warns, err = l.svc.GetTopRatesByLabel(ctx, metricName, key, period, count)
+	l.log.Log(ctx, util.LogLevel(err), "service.GetTopRatesByLabel", "metric", metricName, "key", key, "period", period, "limit", count, "count", len(rates), "warnings", warns, "duration", time.Since(start), "err", err)
 	return
 }
 
-func (l logging) GetEventAttributeValuesByName(ctx context.Context, name string) (vals []string, err error) {
-	vals, err = l.svc.GetEventAttributeValuesByName(ctx, name)
-	l.log.Log(ctx, util.LogLevel(err), fmt.Sprintf("service.GetEventAttributeValuesByName(%s): %d, %s", name, len(vals), err))
+func (l logging) GetEventAttributeTypes(ctx context.Context, metric, sumBy, period string) (attrs Attributes, warns Warnings, err error) {
+	start := time.Now()
+	attrs, warns, err = l.svc.GetEventAttributeTypes(ctx, metric, sumBy, period)
+	l.log.Log(ctx, util.LogLevel(err), "service.GetEventAttributeTypes", "metric", metric, "sumBy", sumBy, "period", period, "attributes", attrs, "warnings", warns, "duration", time.Since(start), "err", err)
 	return
 }
 
-func (l logging) GetDuration(ctx context.Context, metricName string, quantile float64, t time.Duration) (dSeconds float64, errs error) {
-	dSeconds, errs = l.svc.GetDuration(ctx, metricName, quantile, t)
-	l.log.Log(ctx, util.LogLevel(errs), fmt.Sprintf("service.GetDuration(%s, %f, %s): %f, %s", metricName, quantile, t, dSeconds, errs))
+func (l logging) GetEventAttributeValuesByName(ctx context.Context, metric, name string) (vals []string, warns Warnings, err error) {
+	start := time.Now()
+	vals, warns, err = l.svc.GetEventAttributeValuesByName(ctx, metric, name)
+	l.log.Log(ctx, util.LogLevel(err), "service.GetEventAttributeValuesByName", "metric", metric, "name", name, "count", len(vals), "warnings", warns, "duration", time.Since(start), "err", err)
+	return
+}
+
+func (l logging) GetDuration(ctx context.Context, metricName string, quantile float64, t time.Duration) (dSeconds float64, warns Warnings, errs error) {
+	start := time.Now()
+	dSeconds, warns, errs = l.svc.GetDuration(ctx, metricName, quantile, t)
+	l.log.Log(ctx, util.LogLevel(errs), "service.GetDuration", "metric", metricName, "quantile", quantile, "period", t, "seconds", dSeconds, "warnings", warns, "duration", time.Since(start), "err", errs)
+	return
+}
+
+func (l logging) GetSeries(ctx context.Context, metricName string, start, end time.Time, step time.Duration) (series []Point, warns Warnings, err error) {
+	t := time.Now()
+	series, warns, err = l.svc.GetSeries(ctx, metricName, start, end, step)
+	l.log.Log(ctx, util.LogLevel(err), "service.GetSeries", "metric", metricName, "start", start, "end", end, "step", step, "count", len(series), "warnings", warns, "duration", time.Since(t), "err", err)
+	return
+}
+
+func (l logging) GetValue(ctx context.Context, query string) (val float64, warns Warnings, err error) {
+	start := time.Now()
+	val, warns, err = l.svc.GetValue(ctx, query)
+	l.log.Log(ctx, util.LogLevel(err), "service.GetValue", "query", query, "value", val, "warnings", warns, "duration", time.Since(start), "err", err)
+	return
+}
+
+func (l logging) GetVector(ctx context.Context, query string) (vec []Sample, warns Warnings, err error) {
+	start := time.Now()
+	vec, warns, err = l.svc.GetVector(ctx, query)
+	l.log.Log(ctx, util.LogLevel(err), "service.GetVector", "query", query, "count", len(vec), "warnings", warns, "duration", time.Since(start), "err", err)
 	return
 }
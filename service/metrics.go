@@ -23,6 +23,45 @@ type Duration struct {
 }
 
 type ReadStatus struct {
-	ReadRate        float64            `json:"readRate"`
+	ReadRate float64 `json:"readRate"`
+	// SourcesMostRead contains the same page of sources as the Sources but loses the order
 	SourcesMostRead map[string]float64 `json:"sourcesMostRead"`
+	// Sources is the requested page of the most read sources, or all of these when no page is requested,
+	// sorted by the read share descending
+	Sources []SourceShare `json:"sources"`
+	// Other is the total share of the sources after the page
+	Other float64 `json:"other"`
 }
+
+type SourceShare struct {
+	Source string  `json:"source"`
+	Share  float64 `json:"share"`
+}
+
+// LabelRate is the rate of the single label value.
+type LabelRate struct {
+	Label string  `json:"label"`
+	Rate  float64 `json:"rate"`
+}
+
+type SourceStats struct {
+	PublishRate float64 `json:"publishRate"`
+	ReadRate    float64 `json:"readRate"`
+	// ReadShare is the source's share of the total read rate
+	ReadShare float64 `json:"readShare"`
+	// Rank is the source's position by the read rate starting from 1, or 0 when the source was not read
+	Rank int `json:"rank"`
+}
+
+type Point struct {
+	Time  int64   `json:"t"`
+	Value float64 `json:"v"`
+}
+
+type Sample struct {
+	Labels map[string]string `json:"labels"`
+	Value  float64           `json:"value"`
+}
+
+// Warnings are the non-fatal messages returned by Prometheus along with a query result.
+type Warnings []string
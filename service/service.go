@@ -6,16 +6,22 @@ import (
 	"fmt"
 	apiPromV1 "github.com/prometheus/client_golang/api/prometheus/v1"
 	"github.com/prometheus/common/model"
+	"math"
+	"sort"
 	"time"
 )
 
 type Service interface {
-	GetRateAverage(ctx context.Context, metricName string, sumBy string, period string) (rate float64, err error)
-	GetNumberHistory(ctx context.Context, metricName string) (nh NumberHistory, errs error)
-	GetRelativeRateByLabel(ctx context.Context, rateSum float64, metricName string, key string, period string) (rateByKey map[string]float64, errs error)
-	GetEventAttributeTypes(ctx context.Context, metric, sumBy, period string) (attrs Attributes, err error)
-	GetEventAttributeValuesByName(ctx context.Context, name string) (vals []string, err error)
-	GetDuration(ctx context.Context, metricName string, quantile float64, t time.Duration) (dSeconds float64, errs error)
+	GetRateAverage(ctx context.Context, metricName string, sumBy string, period string) (rate float64, warns Warnings, err error)
+	GetNumberHistory(ctx context.Context, metricName string) (nh NumberHistory, warns Warnings, errs error)
+	GetRelativeRateByLabel(ctx context.Context, rateSum float64, metricName string, key string, period string) (rateByKey map[string]float64, warns Warnings, errs error)
+	GetTopRatesByLabel(ctx context.Context, metricName string, key string, period string, count uint32) (rates []LabelRate, warns Warnings, err error)
+	GetEventAttributeTypes(ctx context.Context, metric, sumBy, period string) (attrs Attributes, warns Warnings, err error)
+	GetEventAttributeValuesByName(ctx context.Context, metric, name string) (vals []string, warns Warnings, err error)
+	GetDuration(ctx context.Context, metricName string, quantile float64, t time.Duration) (dSeconds float64, warns Warnings, errs error)
+	GetSeries(ctx context.Context, metricName string, start, end time.Time, step time.Duration) (series []Point, warns Warnings, err error)
+	GetValue(ctx context.Context, query string) (val float64, warns Warnings, err error)
+	GetVector(ctx context.Context, query string) (vec []Sample, warns Warnings, err error)
 }
 
 type service struct {
@@ -23,7 +29,17 @@ type service struct {
 }
 
 const fmtQuerySumRate = "sum by (%s) (rate(%s[%s]))"
+const fmtQueryTopSumRate = "topk(%d, sum by (%s) (rate(%s[%s])))"
 const fmtQueryHistogramQuantile = "histogram_quantile(%f, sum(increase(%s[%s])) by (le))"
+const fmtQuerySum = "sum(%s)"
+
+var ErrUnavailable = errors.New("prometheus unavailable")
+var ErrBadQuery = errors.New("bad query")
+var ErrTimeout = errors.New("query timeout")
+
+// ErrCanceled means the caller has gone, e.g. the client disconnected.
+var ErrCanceled = errors.New("query canceled")
+var ErrEmptyResult = errors.New("empty result")
 
 func NewService(apiProm apiPromV1.API) Service {
 	return service{
@@ -31,79 +47,55 @@ func NewService(apiProm apiPromV1.API) Service {
 	}
 }
 
-func (svc service) GetRateAverage(ctx context.Context, metricName string, sumBy string, period string) (rate float64, errs error) {
-
-	now := time.Now().UTC()
+// GetRateAverage returns zero when there's no data, e.g. nothing happened over the period.
+func (svc service) GetRateAverage(ctx context.Context, metricName string, sumBy string, period string) (rate float64, warns Warnings, err error) {
 	q := fmt.Sprintf(fmtQuerySumRate, sumBy, metricName, period)
-	v, _, err := svc.apiProm.Query(ctx, q, now)
-	if err == nil {
-		if v.Type() == model.ValVector {
-			if vv := v.(model.Vector); len(vv) > 0 {
-				rate = float64(vv[0].Value)
-			}
-		}
+	rate, warns, err = svc.queryScalar(ctx, q, time.Now().UTC())
+	if errors.Is(err, ErrEmptyResult) {
+		err = nil
 	}
 	return
 }
 
-func (svc service) GetNumberHistory(ctx context.Context, metricName string) (nh NumberHistory, errs error) {
+func (svc service) GetNumberHistory(ctx context.Context, metricName string) (nh NumberHistory, warns Warnings, errs error) {
 
 	now := time.Now().UTC()
 
-	v, _, err := svc.apiProm.Query(ctx, metricName, now)
-	if err == nil {
-		if v.Type() == model.ValVector {
-			if vv := v.(model.Vector); len(vv) > 0 {
-				nh.Current = float64(vv[0].Value)
-			}
-		}
-	} else {
-		errs = errors.Join(errs, err)
+	var w Warnings
+	var err error
+	nh.Current, warns, errs = svc.queryScalar(ctx, metricName, now)
+	if errors.Is(errs, ErrEmptyResult) {
+		errs = nil
 	}
 
-	v, _, err = svc.apiProm.Query(ctx, metricName, now.Add(-time.Hour))
-	if err == nil {
-		if v.Type() == model.ValVector {
-			if vv := v.(model.Vector); len(vv) > 0 {
-				nh.Past.Hour = float64(vv[0].Value)
-			}
-		}
-	} else {
+	nh.Past.Hour, w, err = svc.queryScalar(ctx, metricName, now.Add(-time.Hour))
+	warns = append(warns, w...)
+	if err != nil && !errors.Is(err, ErrEmptyResult) {
 		errs = errors.Join(errs, err)
 	}
 
-	v, _, err = svc.apiProm.Query(ctx, metricName, now.Add(-24*time.Hour))
-	if err == nil {
-		if v.Type() == model.ValVector {
-			if vv := v.(model.Vector); len(vv) > 0 {
-				nh.Past.Day = float64(vv[0].Value)
-			}
-		}
-	} else {
+	nh.Past.Day, w, err = svc.queryScalar(ctx, metricName, now.Add(-24*time.Hour))
+	warns = append(warns, w...)
+	if err != nil && !errors.Is(err, ErrEmptyResult) {
 		errs = errors.Join(errs, err)
 	}
 
-	v, _, err = svc.apiProm.Query(ctx, metricName, now.Add(-30*24*time.Hour))
-	if err == nil {
-		if v.Type() == model.ValVector {
-			if vv := v.(model.Vector); len(vv) > 0 {
-				nh.Past.Month = float64(vv[0].Value)
-			}
-		}
-	} else {
+	nh.Past.Month, w, err = svc.queryScalar(ctx, metricName, now.Add(-30*24*time.Hour))
+	warns = append(warns, w...)
+	if err != nil && !errors.Is(err, ErrEmptyResult) {
 		errs = errors.Join(errs, err)
 	}
 
 	return
 }
 
-func (svc service) GetRelativeRateByLabel(ctx context.Context, rateSum float64, metricName string, key string, period string) (rateByKey map[string]float64, err error) {
+func (svc service) GetRelativeRateByLabel(ctx context.Context, rateSum float64, metricName string, key string, period string) (rateByKey map[string]float64, warns Warnings, err error) {
 	rateByKey = make(map[string]float64)
 	now := time.Now().UTC()
 	if rateSum > 0 {
 		q := fmt.Sprintf(fmtQuerySumRate, key, metricName, period)
 		var v model.Value
-		v, _, err = svc.apiProm.Query(ctx, q, now)
+		v, warns, err = svc.query(ctx, q, now)
 		if err == nil {
 			if v.Type() == model.ValVector {
 				vec := v.(model.Vector)
@@ -121,11 +113,39 @@ func (svc service) GetRelativeRateByLabel(ctx context.Context, rateSum float64,
 	return
 }
 
-func (svc service) GetEventAttributeTypes(ctx context.Context, metric, sumBy, period string) (attrs Attributes, err error) {
+func (svc service) GetTopRatesByLabel(ctx context.Context, metricName string, key string, period string, count uint32) (rates []LabelRate, warns Warnings, err error) {
+	rates = []LabelRate{}
+	if count == 0 {
+		return
+	}
+	q := fmt.Sprintf(fmtQueryTopSumRate, count, key, metricName, period)
+	var v model.Value
+	v, warns, err = svc.query(ctx, q, time.Now().UTC())
+	if err == nil && v.Type() == model.ValVector {
+		for _, rec := range v.(model.Vector) {
+			if !math.IsNaN(float64(rec.Value)) {
+				rates = append(rates, LabelRate{
+					Label: string(rec.Metric[model.LabelName(key)]),
+					Rate:  float64(rec.Value),
+				})
+			}
+		}
+		// topk doesn't sort the instant vector
+		sort.SliceStable(rates, func(i, j int) bool {
+			if rates[i].Rate == rates[j].Rate {
+				return rates[i].Label < rates[j].Label
+			}
+			return rates[i].Rate > rates[j].Rate
+		})
+	}
+	return
+}
+
+func (svc service) GetEventAttributeTypes(ctx context.Context, metric, sumBy, period string) (attrs Attributes, warns Warnings, err error) {
 	attrs.TypesByKey = make(map[string][]string)
 	q := fmt.Sprintf(fmtQuerySumRate, sumBy, metric, period)
 	var v model.Value
-	v, _, err = svc.apiProm.Query(ctx, q, time.Now().UTC())
+	v, warns, err = svc.query(ctx, q, time.Now().UTC())
 	if err == nil {
 		if v.Type() == model.ValVector {
 			vec := v.(model.Vector)
@@ -150,10 +170,10 @@ func (svc service) GetEventAttributeTypes(ctx context.Context, metric, sumBy, pe
 	return
 }
 
-func (svc service) GetEventAttributeValuesByName(ctx context.Context, name string) (vals []string, err error) {
-	q := fmt.Sprintf(fmtQuerySumRate, name, "awk_published_events_count", "1w")
+func (svc service) GetEventAttributeValuesByName(ctx context.Context, metric, name string) (vals []string, warns Warnings, err error) {
+	q := fmt.Sprintf(fmtQuerySumRate, name, metric, "1w")
 	var v model.Value
-	v, _, err = svc.apiProm.Query(ctx, q, time.Now().UTC())
+	v, warns, err = svc.query(ctx, q, time.Now().UTC())
 	if err == nil {
 		if v.Type() == model.ValVector {
 			vec := v.(model.Vector)
@@ -167,17 +187,127 @@ func (svc service) GetEventAttributeValuesByName(ctx context.Context, name strin
 	return
 }
 
-func (svc service) GetDuration(ctx context.Context, metricName string, quantile float64, t time.Duration) (dSeconds float64, errs error) {
+func (svc service) GetDuration(ctx context.Context, metricName string, quantile float64, t time.Duration) (dSeconds float64, warns Warnings, err error) {
 	q := fmt.Sprintf(fmtQueryHistogramQuantile, quantile, metricName, t)
-	v, _, err := svc.apiProm.Query(ctx, q, time.Now().UTC())
+	dSeconds, warns, err = svc.queryScalar(ctx, q, time.Now().UTC())
+	return
+}
+
+func (svc service) GetSeries(ctx context.Context, metricName string, start, end time.Time, step time.Duration) (series []Point, warns Warnings, err error) {
+	// sum the series up to get the single one regardless of the query labels
+	q := fmt.Sprintf(fmtQuerySum, metricName)
+	series, warns, err = svc.querySeries(ctx, q, start, end, step)
+	return
+}
+
+func (svc service) GetValue(ctx context.Context, query string) (val float64, warns Warnings, err error) {
+	val, warns, err = svc.queryScalar(ctx, query, time.Now().UTC())
+	return
+}
+
+func (svc service) GetVector(ctx context.Context, query string) (vec []Sample, warns Warnings, err error) {
+	var v model.Value
+	v, warns, err = svc.query(ctx, query, time.Now().UTC())
+	if err == nil && v.Type() == model.ValVector {
+		for _, rec := range v.(model.Vector) {
+			if !math.IsNaN(float64(rec.Value)) {
+				labels := make(map[string]string, len(rec.Metric))
+				for lblName, lblVal := range rec.Metric {
+					labels[string(lblName)] = string(lblVal)
+				}
+				vec = append(vec, Sample{
+					Labels: labels,
+					Value:  float64(rec.Value),
+				})
+			}
+		}
+	}
+	return
+}
+
+func (svc service) query(ctx context.Context, q string, t time.Time) (v model.Value, warns Warnings, err error) {
+	var w apiPromV1.Warnings
+	v, w, err = svc.apiProm.Query(ctx, q, t)
+	warns = Warnings(w)
+	err = decodeError(err)
+	return
+}
+
+// queryScalar expects the query result to be a non-empty vector and returns the value of the first sample.
+func (svc service) queryScalar(ctx context.Context, q string, t time.Time) (val float64, warns Warnings, err error) {
+	var v model.Value
+	v, warns, err = svc.query(ctx, q, t)
 	if err == nil {
-		if v.Type() == model.ValVector {
+		val = math.NaN()
+		switch v.Type() {
+		case model.ValVector:
 			if vv := v.(model.Vector); len(vv) > 0 {
-				dSeconds = float64(vv[0].Value)
+				val = float64(vv[0].Value)
 			}
+		case model.ValScalar:
+			val = float64(v.(*model.Scalar).Value)
 		}
-	} else {
-		errs = errors.Join(errs, err)
+		if math.IsNaN(val) {
+			val = 0
+			err = fmt.Errorf("%w: %s", ErrEmptyResult, q)
+		}
+	}
+	return
+}
+
+// querySeries expects the query result to be a matrix and returns the values of the first series.
+// The empty matrix is the valid empty series.
+func (svc service) querySeries(ctx context.Context, q string, start, end time.Time, step time.Duration) (series []Point, warns Warnings, err error) {
+	r := apiPromV1.Range{
+		Start: start.UTC(),
+		End:   end.UTC(),
+		Step:  step,
+	}
+	var v model.Value
+	var w apiPromV1.Warnings
+	v, w, err = svc.apiProm.QueryRange(ctx, q, r)
+	warns = Warnings(w)
+	err = decodeError(err)
+	if err == nil {
+		if v.Type() != model.ValMatrix {
+			err = fmt.Errorf("%w: unexpected result type %s: %s", ErrBadQuery, v.Type(), q)
+			return
+		}
+		// no data in the range is the valid empty series
+		series = []Point{}
+		if m := v.(model.Matrix); len(m) > 0 {
+			for _, sp := range m[0].Values {
+				if !math.IsNaN(float64(sp.Value)) {
+					series = append(series, Point{
+						Time:  sp.Timestamp.Unix(),
+						Value: float64(sp.Value),
+					})
+				}
+			}
+		}
+	}
+	return
+}
+
+func decodeError(src error) (dst error) {
+	var errProm *apiPromV1.Error
+	switch {
+	case src == nil:
+	case errors.Is(src, context.Canceled):
+		dst = fmt.Errorf("%w: %s", ErrCanceled, src)
+	case errors.Is(src, context.DeadlineExceeded):
+		dst = fmt.Errorf("%w: %s", ErrTimeout, src)
+	case errors.As(src, &errProm):
+		switch errProm.Type {
+		case apiPromV1.ErrBadData:
+			dst = fmt.Errorf("%w: %s", ErrBadQuery, src)
+		case apiPromV1.ErrTimeout, apiPromV1.ErrCanceled:
+			dst = fmt.Errorf("%w: %s", ErrTimeout, src)
+		default:
+			dst = fmt.Errorf("%w: %s", ErrUnavailable, src)
+		}
+	default:
+		dst = fmt.Errorf("%w: %s", ErrUnavailable, src)
 	}
 	return
 }
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	apiPromV1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"net"
+	"testing"
+	"time"
+)
+
+type apiPromMock struct {
+	apiPromV1.API
+	v     model.Value
+	warns apiPromV1.Warnings
+	err   error
+}
+
+func (a apiPromMock) Query(ctx context.Context, query string, ts time.Time, opts ...apiPromV1.Option) (model.Value, apiPromV1.Warnings, error) {
+	return a.v, a.warns, a.err
+}
+
+func (a apiPromMock) QueryRange(ctx context.Context, query string, r apiPromV1.Range, opts ...apiPromV1.Option) (model.Value, apiPromV1.Warnings, error) {
+	return a.v, a.warns, a.err
+}
+
+func TestService_GetRateAverage(t *testing.T) {
+	cases := map[string]struct {
+		api   apiPromMock
+		rate  float64
+		warns Warnings
+		err   error
+	}{
+		"ok": {
+			api: apiPromMock{
+				v: model.Vector{
+					{Value: 1.5},
+				},
+				warns: apiPromV1.Warnings{"warn0"},
+			},
+			rate:  1.5,
+			warns: Warnings{"warn0"},
+		},
+		"empty is zero": {
+			api: apiPromMock{
+				v: model.Vector{},
+			},
+		},
+		"nan is zero": {
+			api: apiPromMock{
+				v: model.Vector{
+					{Value: model.SampleValue(math.NaN())},
+				},
+			},
+		},
+		"bad query": {
+			api: apiPromMock{
+				err: &apiPromV1.Error{Type: apiPromV1.ErrBadData, Msg: "parse error"},
+			},
+			err: ErrBadQuery,
+		},
+		"timeout": {
+			api: apiPromMock{
+				err: &apiPromV1.Error{Type: apiPromV1.ErrTimeout, Msg: "query timed out"},
+			},
+			err: ErrTimeout,
+		},
+		"deadline": {
+			api: apiPromMock{
+				err: fmt.Errorf("post: %w", context.DeadlineExceeded),
+			},
+			err: ErrTimeout,
+		},
+		"canceled": {
+			api: apiPromMock{
+				err: fmt.Errorf("post: %w", context.Canceled),
+			},
+			err: ErrCanceled,
+		},
+		"unavailable": {
+			api: apiPromMock{
+				err: &net.OpError{Op: "dial", Err: errors.New("connection refused")},
+			},
+			err: ErrUnavailable,
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			svc := NewService(c.api)
+			rate, warns, err := svc.GetRateAverage(context.TODO(), "metric0", "service", "1h")
+			assert.Equal(t, c.rate, rate)
+			assert.Equal(t, c.warns, warns)
+			if c.err == nil {
+				assert.Nil(t, err)
+			}
+			assert.ErrorIs(t, err, c.err)
+		})
+	}
+}
+
+func TestService_GetValue_Empty(t *testing.T) {
+	svc := NewService(apiPromMock{
+		v: model.Vector{},
+	})
+	_, _, err := svc.GetValue(context.TODO(), "metric0")
+	assert.ErrorIs(t, err, ErrEmptyResult)
+}
+
+func TestService_GetSeries(t *testing.T) {
+	svc := NewService(apiPromMock{
+		v: model.Matrix{
+			{
+				Values: []model.SamplePair{
+					{Timestamp: 1_000, Value: 1},
+					{Timestamp: 2_000, Value: model.SampleValue(math.NaN())},
+					{Timestamp: 3_000, Value: 3},
+				},
+			},
+		},
+	})
+	series, _, err := svc.GetSeries(context.TODO(), "metric0", time.Unix(0, 0), time.Unix(3, 0), time.Second)
+	assert.Nil(t, err)
+	assert.Equal(t, []Point{{Time: 1, Value: 1}, {Time: 3, Value: 3}}, series)
+}
+
+func TestService_GetSeries_Empty(t *testing.T) {
+	svc := NewService(apiPromMock{
+		v: model.Matrix{},
+	})
+	series, _, err := svc.GetSeries(context.TODO(), "metric0", time.Unix(0, 0), time.Unix(3, 0), time.Second)
+	assert.Nil(t, err)
+	assert.NotNil(t, series)
+	assert.Empty(t, series)
+}
+
+func TestService_GetNumberHistory(t *testing.T) {
+	svc := NewService(apiPromMock{
+		err: &apiPromV1.Error{Type: apiPromV1.ErrServer, Msg: "server error: 503"},
+	})
+	_, _, err := svc.GetNumberHistory(context.TODO(), "metric0")
+	assert.ErrorIs(t, err, ErrUnavailable)
+}
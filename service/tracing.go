@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"time"
+)
+
+type tracing struct {
+	svc    Service
+	tracer trace.Tracer
+}
+
+// NewTracing returns the Service recording the span per Prometheus query.
+// Wrap it with the cache, so the cache hits don't look like queries.
+func NewTracing(svc Service, tracer trace.Tracer) Service {
+	return tracing{
+		svc:    svc,
+		tracer: tracer,
+	}
+}
+
+func (t tracing) start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return t.tracer.Start(ctx, "service."+name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+func endSpan(span trace.Span, warns Warnings, err error) {
+	if len(warns) > 0 {
+		span.SetAttributes(attribute.StringSlice("warnings", warns))
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func (t tracing) GetRateAverage(ctx context.Context, metricName string, sumBy string, period string) (rate float64, warns Warnings, err error) {
+	ctx, span := t.start(ctx, "GetRateAverage", attribute.String("metric", metricName), attribute.String("sumBy", sumBy), attribute.String("period", period))
+	rate, warns, err = t.svc.GetRateAverage(ctx, metricName, sumBy, period)
+	endSpan(span, warns, err)
+	return
+}
+
+func (t tracing) GetNumberHistory(ctx context.Context, metricName string) (nh NumberHistory, warns Warnings, errs error) {
+	ctx, span := t.start(ctx, "GetNumberHistory", attribute.String("metric", metricName))
+	nh, warns, errs = t.svc.GetNumberHistory(ctx, metricName)
+	endSpan(span, warns, errs)
+	return
+}
+
+func (t tracing) GetRelativeRateByLabel(ctx context.Context, rateSum float64, metricName string, key string, period string) (rateByKey map[string]float64, warns Warnings, errs error) {
+	ctx, span := t.start(ctx, "GetRelativeRateByLabel", attribute.String("metric", metricName), attribute.String("key", key), attribute.String("period", period))
+	rateByKey, warns, errs = t.svc.GetRelativeRateByLabel(ctx, rateSum, metricName, key, period)
+	span.SetAttributes(attribute.Int("count", len(rateByKey)))
+	endSpan(span, warns, errs)
+	return
+}
+
+func (t tracing) GetTopRatesByLabel(ctx context.Context, metricName string, key string, period string, count uint32) (rates []LabelRate, warns Warnings, err error) {
+	ctx, span := t.start(ctx, "GetTopRatesByLabel", attribute.String("metric", metricName), attribute.String("key", key), attribute.String("period", period), attribute.Int64("limit", int64(count)))
+	rates, warns, err = t.svc.GetTopRatesByLabel(ctx, metricName, key, period, count)
+	span.SetAttributes(attribute.Int("count", len(rates)))
+	endSpan(span, warns, err)
+	return
+}
+
+func (t tracing) GetEventAttributeTypes(ctx context.Context, metric, sumBy, period string) (attrs Attributes, warns Warnings, err error) {
+	ctx, span := t.start(ctx, "GetEventAttributeTypes", attribute.String("metric", metric), attribute.String("sumBy", sumBy), attribute.String("period", period))
+	attrs, warns, err = t.svc.GetEventAttributeTypes(ctx, metric, sumBy, period)
+	endSpan(span, warns, err)
+	return
+}
+
+func (t tracing) GetEventAttributeValuesByName(ctx context.Context, metric, name string) (vals []string, warns Warnings, err error) {
+	ctx, span := t.start(ctx, "GetEventAttributeValuesByName", attribute.String("metric", metric), attribute.String("name", name))
+	vals, warns, err = t.svc.GetEventAttributeValuesByName(ctx, metric, name)
+	span.SetAttributes(attribute.Int("count", len(vals)))
+	endSpan(span, warns, err)
+	return
+}
+
+func (t tracing) GetDuration(ctx context.Context, metricName string, quantile float64, period time.Duration) (dSeconds float64, warns Warnings, errs error) {
+	ctx, span := t.start(ctx, "GetDuration", attribute.String("metric", metricName), attribute.Float64("quantile", quantile), attribute.String("period", period.String()))
+	dSeconds, warns, errs = t.svc.GetDuration(ctx, metricName, quantile, period)
+	endSpan(span, warns, errs)
+	return
+}
+
+func (t tracing) GetSeries(ctx context.Context, metricName string, start, end time.Time, step time.Duration) (series []Point, warns Warnings, err error) {
+	ctx, span := t.start(ctx, "GetSeries", attribute.String("query", metricName), attribute.String("start", start.String()), attribute.String("end", end.String()), attribute.String("step", step.String()))
+	series, warns, err = t.svc.GetSeries(ctx, metricName, start, end, step)
+	span.SetAttributes(attribute.Int("count", len(series)))
+	endSpan(span, warns, err)
+	return
+}
+
+func (t tracing) GetValue(ctx context.Context, query string) (val float64, warns Warnings, err error) {
+	ctx, span := t.start(ctx, "GetValue", attribute.String("query", query))
+	val, warns, err = t.svc.GetValue(ctx, query)
+	endSpan(span, warns, err)
+	return
+}
+
+func (t tracing) GetVector(ctx context.Context, query string) (vec []Sample, warns Warnings, err error) {
+	ctx, span := t.start(ctx, "GetVector", attribute.String("query", query))
+	vec, warns, err = t.svc.GetVector(ctx, query)
+	span.SetAttributes(attribute.Int("count", len(vec)))
+	endSpan(span, warns, err)
+	return
+}
@@ -0,0 +1,30 @@
+package service
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/codes"
+	sdkTrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"testing"
+)
+
+func TestTracing_GetValue(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	tp := sdkTrace.NewTracerProvider(sdkTrace.WithSpanProcessor(rec))
+	svc := NewTracing(svcValuesMock{
+		values: map[string]float64{
+			"q0": 1,
+		},
+	}, tp.Tracer("test"))
+	val, _, err := svc.GetValue(context.TODO(), "q0")
+	assert.Nil(t, err)
+	assert.Equal(t, float64(1), val)
+	_, _, err = svc.GetValue(context.TODO(), "q1")
+	assert.ErrorIs(t, err, ErrEmptyResult)
+	spans := rec.Ended()
+	assert.Equal(t, 2, len(spans))
+	assert.Equal(t, "service.GetValue", spans[0].Name())
+	assert.Equal(t, codes.Unset, spans[0].Status().Code)
+	assert.Equal(t, codes.Error, spans[1].Status().Code)
+}
@@ -0,0 +1,96 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdkTrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"io"
+	"os"
+)
+
+const (
+	ExporterNone   = "none"
+	ExporterOtlp   = "otlp"
+	ExporterStdout = "stdout"
+	ExporterFile   = "file"
+)
+
+// ServiceName is the tracer name and the service name the spans are exported with.
+const ServiceName = "metrics"
+
+type Config struct {
+	// Exporter is one of: none, otlp, stdout, file.
+	Exporter string
+	// Endpoint is the OTLP gRPC collector address, e.g. "otel-collector:4317".
+	// The standard OTEL_EXPORTER_OTLP_* environment variables are used when empty.
+	Endpoint string
+	Insecure bool
+	// Path is the file to write the spans to with the "file" exporter.
+	Path string
+	// SampleRatio is the share of the root spans to sample, the child spans follow their parent's decision.
+	SampleRatio float64
+}
+
+// Shutdown flushes the pending spans and stops the exporter.
+type Shutdown func(ctx context.Context) (err error)
+
+var ErrInvalidExporter = errors.New("invalid tracing exporter")
+
+// Init sets up the global tracer provider and the W3C trace context propagation.
+// The global no-op provider is kept when the exporter is "none".
+func Init(ctx context.Context, cfg Config) (shutdown Shutdown, err error) {
+	shutdown = func(ctx context.Context) error {
+		return nil
+	}
+	var exp sdkTrace.SpanExporter
+	var out io.Closer
+	switch cfg.Exporter {
+	case ExporterNone, "":
+		return
+	case ExporterOtlp:
+		var opts []otlptracegrpc.Option
+		if cfg.Endpoint != "" {
+			opts = append(opts, otlptracegrpc.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		exp, err = otlptracegrpc.New(ctx, opts...)
+	case ExporterStdout:
+		exp, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterFile:
+		var f *os.File
+		f, err = os.OpenFile(cfg.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err == nil {
+			out = f
+			exp, err = stdouttrace.New(stdouttrace.WithWriter(f))
+		}
+	default:
+		err = fmt.Errorf("%w: %q, should be one of: %s, %s, %s, %s", ErrInvalidExporter, cfg.Exporter, ExporterNone, ExporterOtlp, ExporterStdout, ExporterFile)
+	}
+	if err != nil {
+		return
+	}
+	tp := sdkTrace.NewTracerProvider(
+		sdkTrace.WithBatcher(exp),
+		sdkTrace.WithSampler(sdkTrace.ParentBased(sdkTrace.TraceIDRatioBased(cfg.SampleRatio))),
+		sdkTrace.WithResource(resource.NewSchemaless(semconv.ServiceName(ServiceName))),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	shutdown = func(ctx context.Context) (err error) {
+		err = tp.Shutdown(ctx)
+		if out != nil {
+			err = errors.Join(err, out.Close())
+		}
+		return
+	}
+	return
+}
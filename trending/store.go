@@ -0,0 +1,194 @@
+package trending
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Snapshot is the followers count of the top interests at the moment.
+type Snapshot struct {
+	Time      time.Time   `json:"time"`
+	Interests []Followers `json:"interests"`
+	// Full tells the snapshot contains the complete top, so any interest missing has no more followers than the last one.
+	Full bool `json:"full"`
+}
+
+type Followers struct {
+	Id     string `json:"id"`
+	Count  int64  `json:"count"`
+	Public bool   `json:"public"`
+}
+
+// Store keeps the snapshots local to the service instance.
+type Store interface {
+
+	// Add appends the snapshot and drops the ones older than the retention.
+	Add(s Snapshot, retention time.Duration) (err error)
+
+	// Snapshots returns the snapshots ordered by time.
+	Snapshots() []Snapshot
+}
+
+type storeMemory struct {
+	lock      *sync.RWMutex
+	snapshots *[]Snapshot
+}
+
+func NewStoreMemory() Store {
+	return storeMemory{
+		lock:      &sync.RWMutex{},
+		snapshots: &[]Snapshot{},
+	}
+}
+
+func (sm storeMemory) Add(s Snapshot, retention time.Duration) (err error) {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+	sm.add(s, retention)
+	return
+}
+
+func (sm storeMemory) add(s Snapshot, retention time.Duration) {
+	oldest := s.Time.Add(-retention)
+	*sm.snapshots = slices.DeleteFunc(*sm.snapshots, func(prev Snapshot) bool {
+		return prev.Time.Before(oldest)
+	})
+	*sm.snapshots = append(*sm.snapshots, s)
+	slices.SortStableFunc(*sm.snapshots, func(a, b Snapshot) int {
+		return a.Time.Compare(b.Time)
+	})
+}
+
+func (sm storeMemory) Snapshots() []Snapshot {
+	sm.lock.RLock()
+	defer sm.lock.RUnlock()
+	return slices.Clone(*sm.snapshots)
+}
+
+type storeFile struct {
+	storeMemory
+	path string
+	// lines is the count of the snapshots in the file, including the expired ones
+	lines *int
+}
+
+// NewStoreFile returns the Store persisting the snapshots to the file, so these survive the restart.
+// The file contains the JSON snapshot per line, every new snapshot is appended to it.
+// The file is rewritten without the expired snapshots only when these are as many as the retained ones.
+// The snapshots are loaded from the file when it exists.
+func NewStoreFile(path string) (s Store, err error) {
+	sf := storeFile{
+		storeMemory: NewStoreMemory().(storeMemory),
+		path:        path,
+		lines:       new(int),
+	}
+	var data []byte
+	data, err = os.ReadFile(path)
+	switch {
+	case err == nil:
+		err = sf.load(data)
+	case errors.Is(err, os.ErrNotExist):
+		err = nil
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to load the trending snapshots from %s: %w", path, err)
+	}
+	s = sf
+	return
+}
+
+func (sf storeFile) load(data []byte) (err error) {
+	lines := bytes.Split(bytes.TrimSuffix(data, []byte("\n")), []byte("\n"))
+	var incomplete bool
+	for i, line := range lines {
+		if len(line) == 0 {
+			continue
+		}
+		var snapshot Snapshot
+		err = json.Unmarshal(line, &snapshot)
+		if err != nil && i == len(lines)-1 {
+			// the last append was interrupted
+			incomplete = true
+			err = nil
+			break
+		}
+		if err != nil {
+			return
+		}
+		*sf.snapshots = append(*sf.snapshots, snapshot)
+	}
+	slices.SortStableFunc(*sf.snapshots, func(a, b Snapshot) int {
+		return a.Time.Compare(b.Time)
+	})
+	*sf.lines = len(*sf.snapshots)
+	if incomplete {
+		// don't append to the broken line
+		err = sf.rewrite()
+	}
+	return
+}
+
+func (sf storeFile) Add(s Snapshot, retention time.Duration) (err error) {
+	sf.lock.Lock()
+	defer sf.lock.Unlock()
+	sf.add(s, retention)
+	switch expired := *sf.lines + 1 - len(*sf.snapshots); {
+	case expired >= len(*sf.snapshots):
+		err = sf.rewrite()
+	default:
+		err = sf.append(s)
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to save the trending snapshots to %s: %w", sf.path, err)
+	}
+	return
+}
+
+func (sf storeFile) append(s Snapshot) (err error) {
+	var data []byte
+	data, err = json.Marshal(s)
+	var f *os.File
+	if err == nil {
+		f, err = os.OpenFile(sf.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	}
+	if err == nil {
+		_, err = f.Write(append(data, '\n'))
+		if err == nil {
+			err = f.Sync()
+		}
+		err = errors.Join(err, f.Close())
+	}
+	if err == nil {
+		*sf.lines++
+	}
+	return
+}
+
+// rewrite replaces the file with the retained snapshots only.
+func (sf storeFile) rewrite() (err error) {
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	for _, s := range *sf.snapshots {
+		err = enc.Encode(s)
+		if err != nil {
+			return
+		}
+	}
+	// write to the temporary file first to not leave the broken one on failure
+	tmp := filepath.Join(filepath.Dir(sf.path), "."+filepath.Base(sf.path)+".tmp")
+	err = os.WriteFile(tmp, buf.Bytes(), 0o644)
+	if err == nil {
+		err = os.Rename(tmp, sf.path)
+	}
+	if err == nil {
+		*sf.lines = len(*sf.snapshots)
+	}
+	return
+}
@@ -0,0 +1,242 @@
+package trending
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/awakari/metrics/api/grpc/auth"
+	"github.com/awakari/metrics/api/grpc/interests"
+	"github.com/awakari/metrics/promql"
+	"github.com/awakari/metrics/util"
+	"github.com/prometheus/common/model"
+	"log/slog"
+	"math"
+	"slices"
+	"time"
+)
+
+// Tracker periodically snapshots the followers of the top interests and ranks these by the followers growth.
+type Tracker interface {
+
+	// Start takes the snapshot every interval until the context is done.
+	Start(ctx context.Context)
+
+	// Snapshot takes the single snapshot.
+	// The interests failed to read keep their followers count from the previous snapshot, the failures are returned.
+	Snapshot(ctx context.Context) (err error)
+
+	// Trending returns the page of the public interests ranked by the followers growth rate over the period.
+	// The period is one of the Periods. The growth is computed over the shorter period when there's not enough history yet.
+	Trending(period time.Duration, offset, limit uint32) (list []Growth)
+}
+
+// Growth is the interest followers change over the period.
+type Growth struct {
+	Id        string `json:"id"`
+	Followers int64  `json:"followers"`
+	Delta     int64  `json:"delta"`
+	// Rate is the followers gained per hour.
+	Rate  float64   `json:"rate"`
+	Since time.Time `json:"since"`
+}
+
+type Config struct {
+	Interval time.Duration
+	// Top is the count of the interests with the most followers to track.
+	Top uint32
+	// ReadParallelism and ReadTimeout define how the interests are read.
+	ReadParallelism uint32
+	ReadTimeout     time.Duration
+}
+
+// Periods are the supported growth periods.
+var Periods = []time.Duration{
+	time.Hour,
+	24 * time.Hour,
+	7 * 24 * time.Hour,
+}
+
+// searchLimit is the max count of the interests to request at once.
+const searchLimit = 100
+
+const cursorIdMax = "zzzzzzzz-zzzz-zzzz-zzzz-zzzzzzzzzzzz"
+
+type tracker struct {
+	clientInterests interests.ServiceClient
+	groupIdDefault  string
+	store           Store
+	cfg             Config
+	log             *slog.Logger
+}
+
+func NewTracker(clientInterests interests.ServiceClient, groupIdDefault string, store Store, cfg Config, log *slog.Logger) Tracker {
+	return tracker{
+		clientInterests: clientInterests,
+		groupIdDefault:  groupIdDefault,
+		store:           store,
+		cfg:             cfg,
+		log:             log,
+	}
+}
+
+// ParsePeriod parses the Prometheus duration and checks it's one of the Periods.
+func ParsePeriod(s string) (period time.Duration, err error) {
+	var d model.Duration
+	d, err = model.ParseDuration(s)
+	period = time.Duration(d)
+	if err != nil || !slices.Contains(Periods, period) {
+		err = fmt.Errorf("%w: trending period should be one of 1h, 1d, 1w: %q", promql.ErrInvalid, s)
+	}
+	return
+}
+
+func (t tracker) Start(ctx context.Context) {
+	tick := time.NewTicker(t.cfg.Interval)
+	defer tick.Stop()
+	for {
+		err := t.Snapshot(ctx)
+		if err != nil {
+			t.log.Warn("interests trending snapshot failure", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+	}
+}
+
+func (t tracker) Snapshot(ctx context.Context) (err error) {
+	s := Snapshot{
+		Time: time.Now().UTC(),
+	}
+	followersByIdPrev := make(map[string]Followers)
+	if snapshots := t.store.Snapshots(); len(snapshots) > 0 {
+		for _, f := range snapshots[len(snapshots)-1].Interests {
+			followersByIdPrev[f.Id] = f
+		}
+	}
+	ctx = auth.SetOutgoingAuthInfo(ctx, t.groupIdDefault, "metrics")
+	cursor := &interests.Cursor{
+		Id:        cursorIdMax,
+		Followers: math.MaxInt64,
+	}
+	seen := make(map[string]bool)
+	complete := true
+	var errs error
+	for len(s.Interests) < int(t.cfg.Top) {
+		limit := min(t.cfg.Top-uint32(len(s.Interests)), searchLimit)
+		var resp *interests.SearchResponse
+		resp, err = t.clientInterests.Search(ctx, &interests.SearchRequest{
+			Cursor: cursor,
+			Limit:  limit,
+			Order:  interests.Order_DESC,
+			Sort:   interests.Sort_FOLLOWERS,
+		})
+		if err != nil {
+			return
+		}
+		results := util.FanOut(ctx, resp.Ids, int(t.cfg.ReadParallelism), t.cfg.ReadTimeout, func(ctx context.Context, id string) (*interests.ReadResponse, error) {
+			return t.clientInterests.Read(ctx, &interests.ReadRequest{
+				Id: id,
+			})
+		})
+		var read bool
+		for i, r := range results {
+			id := resp.Ids[i]
+			if seen[id] {
+				continue
+			}
+			if r.Err != nil {
+				errs = errors.Join(errs, fmt.Errorf("%s: %w", id, r.Err))
+				// the drop to zero would look like the followers loss, carry the previous count forward instead
+				prev, ok := followersByIdPrev[id]
+				if ok {
+					seen[id] = true
+					s.Interests = append(s.Interests, prev)
+				} else {
+					complete = false
+				}
+				continue
+			}
+			seen[id] = true
+			s.Interests = append(s.Interests, Followers{
+				Id:     id,
+				Count:  r.Out.Followers,
+				Public: r.Out.Public,
+			})
+			// only the interest read has the actual sort key, the ones failed after it are searched again
+			cursor = &interests.Cursor{
+				Id:        id,
+				Followers: r.Out.Followers,
+			}
+			read = true
+		}
+		if len(resp.Ids) < int(limit) {
+			break
+		}
+		if !read {
+			// no way to get the next page start
+			complete = false
+			break
+		}
+	}
+	s.Full = complete && len(s.Interests) >= int(t.cfg.Top)
+	err = t.store.Add(s, Periods[len(Periods)-1]+2*t.cfg.Interval)
+	if err == nil && errs != nil {
+		err = fmt.Errorf("failed to read the interests, the previous followers counts are kept: %w", errs)
+	}
+	return
+}
+
+func (t tracker) Trending(period time.Duration, offset, limit uint32) (list []Growth) {
+	list = []Growth{}
+	snapshots := t.store.Snapshots()
+	if len(snapshots) < 2 {
+		return
+	}
+	latest := snapshots[len(snapshots)-1]
+	// the latest snapshot not newer than the period start, the oldest one when the history is shorter than the period
+	base := snapshots[0]
+	for _, s := range snapshots[:len(snapshots)-1] {
+		if s.Time.After(latest.Time.Add(-period)) {
+			break
+		}
+		base = s
+	}
+	hours := latest.Time.Sub(base.Time).Hours()
+	countByIdBase := make(map[string]int64, len(base.Interests))
+	for _, f := range base.Interests {
+		countByIdBase[f.Id] = f.Count
+	}
+	for _, f := range latest.Interests {
+		if !f.Public {
+			continue
+		}
+		countBase, ok := countByIdBase[f.Id]
+		switch {
+		case ok:
+		case base.Full && len(base.Interests) > 0:
+			// the interest was below the top, so it had at most as many followers as the last one
+			countBase = min(base.Interests[len(base.Interests)-1].Count, f.Count)
+		}
+		delta := f.Count - countBase
+		if delta > 0 {
+			list = append(list, Growth{
+				Id:        f.Id,
+				Followers: f.Count,
+				Delta:     delta,
+				Rate:      float64(delta) / hours,
+				Since:     base.Time,
+			})
+		}
+	}
+	slices.SortStableFunc(list, func(a, b Growth) int {
+		return cmp.Or(cmp.Compare(b.Rate, a.Rate), cmp.Compare(b.Followers, a.Followers), cmp.Compare(a.Id, b.Id))
+	})
+	start := min(int(offset), len(list))
+	end := min(start+int(limit), len(list))
+	list = list[start:end]
+	return
+}
@@ -0,0 +1,234 @@
+package trending
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/awakari/metrics/api/grpc/interests"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type clientInterestsFake struct {
+	interests.ServiceClient
+	// ids are sorted by followers desc
+	ids       []string
+	followers map[string]int64
+	failing   map[string]bool
+}
+
+func (c clientInterestsFake) Search(ctx context.Context, req *interests.SearchRequest, opts ...grpc.CallOption) (resp *interests.SearchResponse, err error) {
+	resp = &interests.SearchResponse{}
+	for _, id := range c.ids {
+		f := c.followers[id]
+		if f < req.Cursor.Followers || (f == req.Cursor.Followers && id < req.Cursor.Id) {
+			resp.Ids = append(resp.Ids, id)
+		}
+	}
+	resp.Ids = resp.Ids[:min(len(resp.Ids), int(req.Limit))]
+	return
+}
+
+func (c clientInterestsFake) Read(ctx context.Context, req *interests.ReadRequest, opts ...grpc.CallOption) (resp *interests.ReadResponse, err error) {
+	if c.failing[req.Id] {
+		err = errors.New("unavailable")
+		return
+	}
+	resp = &interests.ReadResponse{
+		Followers: c.followers[req.Id],
+		Public:    req.Id != "private",
+	}
+	return
+}
+
+func TestTracker_Snapshot(t *testing.T) {
+	store := NewStoreMemory()
+	tr := NewTracker(
+		clientInterestsFake{
+			ids: []string{"i0", "private", "i1", "i2"},
+			followers: map[string]int64{
+				"i0":      30,
+				"private": 20,
+				"i1":      10,
+				"i2":      5,
+			},
+		},
+		"group0",
+		store,
+		Config{
+			Interval:        time.Hour,
+			Top:             3,
+			ReadParallelism: 2,
+			ReadTimeout:     time.Second,
+		},
+		slog.New(slog.NewTextHandler(io.Discard, nil)),
+	)
+	err := tr.Snapshot(context.TODO())
+	assert.Nil(t, err)
+	snapshots := store.Snapshots()
+	assert.Equal(t, 1, len(snapshots))
+	assert.True(t, snapshots[0].Full)
+	assert.Equal(t, []Followers{
+		{"i0", 30, true},
+		{"private", 20, false},
+		{"i1", 10, true},
+	}, snapshots[0].Interests)
+}
+
+func TestTracker_Snapshot_ReadFailure(t *testing.T) {
+	store := NewStoreMemory()
+	client := clientInterestsFake{
+		ids: []string{"i0", "i1", "i2", "i3"},
+		followers: map[string]int64{
+			"i0": 30,
+			"i1": 20,
+			"i2": 10,
+			"i3": 5,
+		},
+		failing: map[string]bool{},
+	}
+	cfg := Config{
+		Interval:        time.Hour,
+		Top:             3,
+		ReadParallelism: 2,
+		ReadTimeout:     time.Second,
+	}
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	assert.Nil(t, NewTracker(client, "group0", store, cfg, log).Snapshot(context.TODO()))
+	client.followers["i0"] = 40
+	client.followers["i1"] = 25
+	client.failing["i1"] = true
+	client.failing["i2"] = true
+	err := NewTracker(client, "group0", store, cfg, log).Snapshot(context.TODO())
+	assert.ErrorContains(t, err, "i1: unavailable")
+	assert.ErrorContains(t, err, "i2: unavailable")
+	snapshots := store.Snapshots()
+	assert.Equal(t, 2, len(snapshots))
+	assert.True(t, snapshots[1].Full)
+	assert.Equal(t, []Followers{
+		{"i0", 40, true},
+		{"i1", 20, true},
+		{"i2", 10, true},
+	}, snapshots[1].Interests)
+}
+
+func TestTracker_Trending(t *testing.T) {
+	now := time.Now().UTC()
+	store := NewStoreMemory()
+	retention := 8 * 24 * time.Hour
+	assert.Nil(t, store.Add(Snapshot{
+		Time: now.Add(-2 * time.Hour),
+		Interests: []Followers{
+			{"i0", 100, true},
+			{"i1", 50, true},
+		},
+		Full: true,
+	}, retention))
+	assert.Nil(t, store.Add(Snapshot{
+		Time: now.Add(-time.Hour),
+		Interests: []Followers{
+			{"i0", 110, true},
+			{"i1", 50, true},
+			{"private", 40, false},
+		},
+		Full: true,
+	}, retention))
+	assert.Nil(t, store.Add(Snapshot{
+		Time: now,
+		Interests: []Followers{
+			{"i0", 112, true},
+			{"i2", 80, true},
+			{"i1", 60, true},
+			{"private", 60, false},
+		},
+		Full: true,
+	}, retention))
+	tr := NewTracker(nil, "group0", store, Config{}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	cases := map[string]struct {
+		period time.Duration
+		offset uint32
+		limit  uint32
+		ids    []string
+		rates  []float64
+	}{
+		"1h": {
+			period: time.Hour,
+			limit:  10,
+			// i2 was below the full top of 3 interests, so it had at most 40 followers
+			ids:   []string{"i2", "i1", "i0"},
+			rates: []float64{40, 10, 2},
+		},
+		"1d falls back to the oldest snapshot": {
+			period: 24 * time.Hour,
+			limit:  10,
+			// i2 was below the full top of 2 interests, so it had at most 50 followers
+			ids:   []string{"i2", "i0", "i1"},
+			rates: []float64{15, 6, 5},
+		},
+		"page": {
+			period: time.Hour,
+			offset: 1,
+			limit:  1,
+			ids:    []string{"i1"},
+			rates:  []float64{10},
+		},
+	}
+	for k, c := range cases {
+		t.Run(k, func(t *testing.T) {
+			list := tr.Trending(c.period, c.offset, c.limit)
+			assert.Equal(t, len(c.ids), len(list))
+			for i, g := range list {
+				assert.Equal(t, c.ids[i], g.Id)
+				assert.InDelta(t, c.rates[i], g.Rate, 1e-9)
+			}
+		})
+	}
+}
+
+func TestStoreFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trending.json")
+	s, err := NewStoreFile(path)
+	assert.Nil(t, err)
+	now := time.Now().UTC()
+	assert.Nil(t, s.Add(Snapshot{Time: now.Add(-2 * time.Hour)}, time.Hour))
+	assert.Nil(t, s.Add(Snapshot{Time: now, Interests: []Followers{{"i0", 1, true}}}, time.Hour))
+	s, err = NewStoreFile(path)
+	assert.Nil(t, err)
+	snapshots := s.Snapshots()
+	assert.Equal(t, 1, len(snapshots))
+	assert.True(t, now.Equal(snapshots[0].Time))
+	assert.Equal(t, []Followers{{"i0", 1, true}}, snapshots[0].Interests)
+}
+
+func TestStoreFile_Append(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trending.json")
+	s, err := NewStoreFile(path)
+	assert.Nil(t, err)
+	now := time.Now().UTC()
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, s.Add(Snapshot{Time: now.Add(time.Duration(i) * time.Minute)}, time.Hour))
+	}
+	data, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, bytes.Count(data, []byte("\n")))
+	// interrupted while appending
+	assert.Nil(t, os.WriteFile(path, append(data, []byte(`{"time":"20`)...), 0o644))
+	s, err = NewStoreFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(s.Snapshots()))
+	assert.Nil(t, s.Add(Snapshot{Time: now.Add(3 * time.Minute)}, time.Hour))
+	s, err = NewStoreFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(s.Snapshots()))
+	// the expired snapshots are dropped from the file when there are as many of them as the retained ones
+	assert.Nil(t, s.Add(Snapshot{Time: now.Add(2 * time.Hour)}, time.Hour))
+	data, err = os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, bytes.Count(data, []byte("\n")))
+}
@@ -0,0 +1,48 @@
+package util
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Result is the outcome of the single fan-out call.
+type Result[O any] struct {
+	Out O
+	Err error
+}
+
+// FanOut calls the function for every input running at most the parallelism calls at once, each limited by the timeout.
+// The results are in the same order as the inputs. A failed call doesn't affect the others and is reported in its Result.
+// The inputs not yet started when the context is done get the context error.
+func FanOut[I, O any](ctx context.Context, inputs []I, parallelism int, timeout time.Duration, f func(ctx context.Context, in I) (O, error)) (results []Result[O]) {
+	results = make([]Result[O], len(inputs))
+	sem := make(chan struct{}, max(parallelism, 1))
+	wg := sync.WaitGroup{}
+	for i, in := range inputs {
+		// select doesn't prefer the done context when the semaphore is free too
+		if err := ctx.Err(); err != nil {
+			results[i].Err = err
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			results[i].Err = ctx.Err()
+			continue
+		case sem <- struct{}{}:
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				<-sem
+			}()
+			ctxCall, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			// each goroutine writes only its own result, no lock is needed
+			results[i].Out, results[i].Err = f(ctxCall, in)
+		}()
+	}
+	wg.Wait()
+	return
+}
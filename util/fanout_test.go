@@ -0,0 +1,61 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFanOut(t *testing.T) {
+	errFail := errors.New("fail")
+	var running, runningMax atomic.Int32
+	inputs := []int{0, 1, 2, 3, 4, 5, 6, 7}
+	results := FanOut(context.TODO(), inputs, 3, 100*time.Millisecond, func(ctx context.Context, in int) (out int, err error) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			m := runningMax.Load()
+			if n <= m || runningMax.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		switch in {
+		case 3:
+			err = errFail
+		case 5:
+			<-ctx.Done()
+			err = ctx.Err()
+		default:
+			time.Sleep(10 * time.Millisecond)
+			out = in * 10
+		}
+		return
+	})
+	assert.Equal(t, len(inputs), len(results))
+	assert.LessOrEqual(t, runningMax.Load(), int32(3))
+	for i, r := range results {
+		switch i {
+		case 3:
+			assert.ErrorIs(t, r.Err, errFail)
+		case 5:
+			assert.ErrorIs(t, r.Err, context.DeadlineExceeded)
+		default:
+			assert.Nil(t, r.Err)
+			assert.Equal(t, i*10, r.Out)
+		}
+	}
+}
+
+func TestFanOut_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	results := FanOut(ctx, []int{0, 1}, 1, time.Second, func(ctx context.Context, in int) (int, error) {
+		return in, nil
+	})
+	for _, r := range results {
+		assert.ErrorIs(t, r.Err, context.Canceled)
+	}
+}
@@ -1,6 +1,19 @@
 package util
 
-import "log/slog"
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+)
+
+const (
+	LogFormatText = "text"
+	LogFormatJson = "json"
+)
+
+// LogKeyRequestId is the log attribute to correlate the records of the same request.
+const LogKeyRequestId = "requestId"
 
 func LogLevel(err error) (lvl slog.Level) {
 	switch err {
@@ -11,3 +24,48 @@ func LogLevel(err error) (lvl slog.Level) {
 	}
 	return
 }
+
+// NewLogger returns the logger writing in the given format, "text" or "json".
+// The records logged with the context carrying the request id get the "requestId" attribute.
+func NewLogger(w io.Writer, format string, level slog.Level) (log *slog.Logger, err error) {
+	opts := slog.HandlerOptions{
+		Level: level,
+	}
+	var h slog.Handler
+	switch format {
+	case LogFormatText:
+		h = slog.NewTextHandler(w, &opts)
+	case LogFormatJson:
+		h = slog.NewJSONHandler(w, &opts)
+	default:
+		err = fmt.Errorf("unknown log format %q, should be %q or %q", format, LogFormatText, LogFormatJson)
+		return
+	}
+	log = slog.New(logHandlerContext{
+		Handler: h,
+	})
+	return
+}
+
+type logHandlerContext struct {
+	slog.Handler
+}
+
+func (h logHandlerContext) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestId(ctx); id != "" {
+		r.AddAttrs(slog.String(LogKeyRequestId, id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h logHandlerContext) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return logHandlerContext{
+		Handler: h.Handler.WithAttrs(attrs),
+	}
+}
+
+func (h logHandlerContext) WithGroup(name string) slog.Handler {
+	return logHandlerContext{
+		Handler: h.Handler.WithGroup(name),
+	}
+}
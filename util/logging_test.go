@@ -0,0 +1,35 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"log/slog"
+	"testing"
+)
+
+func TestNewLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	log, err := NewLogger(buf, LogFormatJson, slog.LevelDebug)
+	assert.Nil(t, err)
+	log.With("svc", "test").Log(WithRequestId(context.TODO(), "req0"), slog.LevelError, "failure", "err", errors.New("fail"))
+	var rec map[string]any
+	assert.Nil(t, json.Unmarshal(buf.Bytes(), &rec))
+	assert.Equal(t, "failure", rec["msg"])
+	assert.Equal(t, "req0", rec[LogKeyRequestId])
+	assert.Equal(t, "test", rec["svc"])
+	assert.Equal(t, "fail", rec["err"])
+	//
+	_, err = NewLogger(buf, "xml", slog.LevelDebug)
+	assert.NotNil(t, err)
+}
+
+func TestValidRequestId(t *testing.T) {
+	assert.True(t, ValidRequestId(NewRequestId()))
+	assert.True(t, ValidRequestId("trace-1.2_3"))
+	assert.False(t, ValidRequestId(""))
+	assert.False(t, ValidRequestId("a b"))
+	assert.False(t, ValidRequestId(string(make([]byte, 65))))
+}
@@ -0,0 +1,40 @@
+package util
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+type keyRequestId struct{}
+
+// requestIdLenMax limits the request id accepted from the client.
+const requestIdLenMax = 64
+
+// WithRequestId returns the context carrying the request id to correlate the logs and the outgoing calls.
+func WithRequestId(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, keyRequestId{}, id)
+}
+
+// RequestId returns the request id from the context, empty when not set.
+func RequestId(ctx context.Context) (id string) {
+	id, _ = ctx.Value(keyRequestId{}).(string)
+	return
+}
+
+// NewRequestId returns the random request id.
+func NewRequestId() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// ValidRequestId tells whether the request id received from the client may be reused.
+func ValidRequestId(id string) (ok bool) {
+	ok = id != "" && len(id) <= requestIdLenMax
+	for i := 0; ok && i < len(id); i++ {
+		c := id[i]
+		ok = c == '-' || c == '_' || c == '.' || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+	}
+	return
+}